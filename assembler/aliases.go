@@ -0,0 +1,206 @@
+package assembler
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// A symbol which an alias can not be named after, where constants defined outside of
+// the source have no instruction
+type definedSymbol struct {
+	kind        string
+	instruction ast.Instruction
+}
+
+type aliasResolver struct {
+	// Aliases by the global label they belong to, where "" holds the aliases for the whole program
+	aliases map[string]map[string]*ast.AliasDirective
+	// The global label which each alias belongs to
+	scopes map[*ast.AliasDirective]string
+	// The fully resolved target of each alias, and the aliases currently being resolved
+	targets   map[*ast.AliasDirective]ast.AInstructionValue
+	resolving map[*ast.AliasDirective]bool
+	errs      ErrorList
+}
+
+// Replaces each use of an alias with its target, and removes the .alias directives, so
+// that an alias is only another name for an existing symbol rather than a new variable.
+//
+// Aliases before the first label can be used anywhere. Aliases after a label belong to it,
+// and can only be used until the next label, so that each routine can name the same scratch
+// register differently. Aliases within a macro are renamed for each expansion, and so
+// belong to the macro.
+func (a *Assembler) resolveAliases(program ast.Program) (ast.Program, ErrorList) {
+	r := &aliasResolver{
+		aliases:   map[string]map[string]*ast.AliasDirective{},
+		scopes:    map[*ast.AliasDirective]string{},
+		targets:   map[*ast.AliasDirective]ast.AInstructionValue{},
+		resolving: map[*ast.AliasDirective]bool{},
+	}
+
+	// Aliases can not reuse the name of a label, variable or constant, as they would hide them
+	defined := map[string]definedSymbol{}
+	for name := range a.Constants {
+		defined[name] = definedSymbol{kind: "constant"}
+	}
+
+	scopes := make([]string, len(program.Instructions))
+	scope := ""
+	for index, instruction := range program.Instructions {
+		switch instruction := instruction.(type) {
+		case *ast.LInstruction:
+			if !isLocalLabel(instruction.Value) && !isGeneratedSymbol(instruction.Value) {
+				scope = instruction.Value
+				defined[instruction.Value] = definedSymbol{"label", instruction}
+			}
+		case *ast.VarDirective:
+			defined[instruction.Name] = definedSymbol{"variable", instruction}
+		case *ast.ConstantDirective:
+			defined[instruction.Name] = definedSymbol{"constant", instruction}
+		}
+		scopes[index] = scope
+	}
+
+	var order []*ast.AliasDirective
+	for index, instruction := range program.Instructions {
+		if alias, ok := instruction.(*ast.AliasDirective); ok && r.define(alias, scopes[index], defined) {
+			order = append(order, alias)
+		}
+	}
+
+	// Every alias is resolved, even when unused, so that an alias which refers to itself is always reported
+	for _, alias := range order {
+		r.resolve(alias)
+	}
+
+	var instructions []ast.Instruction
+	for index, instruction := range program.Instructions {
+		replace := func(variable *ast.Variable) ast.AInstructionValue {
+			return r.replace(variable, scopes[index])
+		}
+
+		switch instruction := instruction.(type) {
+		case *ast.AliasDirective:
+			continue
+		case *ast.AInstruction:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		case *ast.ConstantDirective:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		case *ast.LoadInstruction:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		}
+		instructions = append(instructions, instruction)
+	}
+
+	return ast.Program{Instructions: instructions}, r.errs
+}
+
+// Adds the alias to the label it belongs to, reporting whether it was valid
+func (r *aliasResolver) define(alias *ast.AliasDirective, scope string, defined map[string]definedSymbol) bool {
+	err := &AssemblyError{
+		Rule:        InvalidAlias,
+		Phase:       RESOLVE,
+		Instruction: alias,
+		Span:        nodeSpan(alias),
+	}
+
+	if symboltable.IsPredefined(alias.Name) {
+		err.Message = fmt.Sprintf("alias %q redefines a predefined symbol", alias.Name)
+		err.Help = fmt.Sprintf("give the alias a different name, such as .alias my_%s %s", alias.Name, alias.Name)
+		r.errs = append(r.errs, err)
+		return false
+	}
+	if symbol, ok := defined[alias.Name]; ok {
+		err.Message = fmt.Sprintf("alias %q is already defined as a %s", alias.Name, symbol.kind)
+		if symbol.instruction != nil {
+			err.Related = []Related{
+				{Span: nodeSpan(symbol.instruction), Message: fmt.Sprintf("%s %q is defined here", symbol.kind, alias.Name)},
+			}
+		}
+		r.errs = append(r.errs, err)
+		return false
+	}
+
+	if r.aliases[scope] == nil {
+		r.aliases[scope] = map[string]*ast.AliasDirective{}
+	}
+	if previous, ok := r.aliases[scope][alias.Name]; ok {
+		err.Rule = DuplicateAlias
+		err.Message = fmt.Sprintf("alias %q is already defined", alias.Name)
+		err.Related = []Related{
+			{Span: nodeSpan(previous), Message: fmt.Sprintf("alias %q was first defined here", alias.Name)},
+		}
+		if scope != "" {
+			err.Message = fmt.Sprintf("alias %q is already defined within %q", alias.Name, scope)
+		}
+		r.errs = append(r.errs, err)
+		return false
+	}
+
+	r.aliases[scope][alias.Name] = alias
+	r.scopes[alias] = scope
+	return true
+}
+
+// Finds the alias visible from the given label, where aliases of the label hide those of the whole program
+func (r *aliasResolver) lookup(name string, scope string) (*ast.AliasDirective, bool) {
+	if alias, ok := r.aliases[scope][name]; ok {
+		return alias, true
+	}
+
+	alias, ok := r.aliases[""][name]
+	return alias, ok
+}
+
+func (r *aliasResolver) replace(variable *ast.Variable, scope string) ast.AInstructionValue {
+	alias, ok := r.lookup(variable.Name, scope)
+	if !ok {
+		return variable
+	}
+
+	// The target takes the position of the reference, so that any error is reported where the alias is used
+	switch target := r.resolve(alias).(type) {
+	case *ast.Variable:
+		return &ast.Variable{Name: target.Name, Span: variable.Span}
+	case *ast.Number:
+		return &ast.Number{Value: target.Value, Span: variable.Span}
+	case nil:
+		return variable
+	default:
+		return &ast.ParenExpression{Expression: target, Span: variable.Span}
+	}
+}
+
+// The target of an alias, where any aliases within the target are also replaced
+func (r *aliasResolver) resolve(alias *ast.AliasDirective) ast.AInstructionValue {
+	if target, ok := r.targets[alias]; ok {
+		return target
+	}
+
+	if r.resolving[alias] {
+		r.errs = append(r.errs, &AssemblyError{
+			Rule:        InvalidAlias,
+			Phase:       RESOLVE,
+			Instruction: alias,
+			Span:        nodeSpan(alias),
+			Message:     fmt.Sprintf("alias %q refers to itself", alias.Name),
+		})
+		r.targets[alias] = nil
+		return nil
+	}
+
+	r.resolving[alias] = true
+	target := ast.ReplaceVariables(alias.Target, func(variable *ast.Variable) ast.AInstructionValue {
+		return r.replace(variable, r.scopes[alias])
+	})
+	delete(r.resolving, alias)
+
+	// A cycle may have been found whilst resolving the target
+	if existing, ok := r.targets[alias]; ok {
+		return existing
+	}
+	r.targets[alias] = target
+	return target
+}
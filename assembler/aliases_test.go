@@ -0,0 +1,127 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases(t *testing.T) {
+	input := `
+	.alias ret_addr R13
+	.alias next_row SCREEN+32
+		@ret_addr
+		M=D
+		@next_row
+		D=#ret_addr
+	`
+	a := New()
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000001101
+		1110001100001000
+		0100000000100000
+		0000000000001101
+		1110110000010000
+	`), result)
+	// Aliases are not variables, and so use no RAM
+	assert.Equal(t, 0, a.Stats().Variables)
+}
+
+func TestAliasesAreScopedToTheirLabel(t *testing.T) {
+	input := `
+	.alias scratch R15
+	(MULTIPLY)
+	.alias result R13
+		@result
+		@scratch
+	(DIVIDE)
+	.alias result R14
+	.alias scratch R5
+		@result
+		@scratch
+	(END)
+		@result
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000001101
+		0000000000001111
+		0000000000001110
+		0000000000000101
+		0000000000010000
+	`), result)
+}
+
+func TestAliasesWithinMacros(t *testing.T) {
+	input := `
+	.macro SAVE
+	.alias saved R13
+		@saved
+		M=D
+	.endm
+	.alias saved R14
+		SAVE
+		@saved
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000001101
+		1110001100001000
+		0000000000001110
+	`), result)
+}
+
+func TestAliasErrors(t *testing.T) {
+	input := `
+	.equ WIDTH 512
+	.alias SP R13
+	.alias WIDTH R14
+	.alias LOOP R14
+	.alias first second
+	.alias second first
+	(LOOP)
+	.alias tmp R13
+	.alias tmp R14
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 5)
+
+	assert.Equal(t, InvalidAlias, errs[0].Rule)
+	assert.Equal(t, `alias "SP" redefines a predefined symbol`, errs[0].Message)
+	assert.Equal(t, `alias "WIDTH" is already defined as a constant`, errs[1].Message)
+	assert.Equal(t, `alias "LOOP" is already defined as a label`, errs[2].Message)
+
+	assert.Equal(t, DuplicateAlias, errs[3].Rule)
+	assert.Equal(t, `alias "tmp" is already defined within "LOOP"`, errs[3].Message)
+	assert.Equal(t, 9, errs[3].Related[0].Span.Start.Line)
+
+	assert.Equal(t, InvalidAlias, errs[4].Rule)
+	assert.Equal(t, `alias "first" refers to itself`, errs[4].Message)
+}
+
+func TestAliasesCanNotHideDeclaredVariables(t *testing.T) {
+	input := `
+	.var x
+	.alias x R13
+		@x
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, InvalidAlias, errs[0].Rule)
+	assert.Equal(t, `alias "x" is already defined as a variable`, errs[0].Message)
+	assert.Equal(t, []Related{
+		{Span: errs[0].Related[0].Span, Message: `variable "x" is defined here`},
+	}, errs[0].Related)
+	assert.Equal(t, 2, errs[0].Related[0].Span.Start.Line)
+}
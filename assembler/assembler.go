@@ -8,48 +8,318 @@ import (
 	"github.com/alanfoster/assembler/ast"
 	"github.com/alanfoster/assembler/symboltable"
 	"fmt"
+	"errors"
+	"github.com/alanfoster/assembler/token"
+	"io/ioutil"
 )
 
 type Assembler struct {
+	// The number of parse errors reported before giving up, zero or less reports every error
+	MaxErrors int
+	// Whether each warning is reported, keyed by its identifier
+	EnabledWarnings map[string]bool
+	// Reports warnings as errors, so that the program fails to assemble
+	WarningsAsErrors bool
+	// Constants defined outside of the source, such as from the command line
+	Constants map[string]int
+	// The exclusive upper bound for variable addresses. Zero or less, or values beyond the
+	// start of the screen, allow variables to use all RAM up until the screen.
+	VariableCeiling int
+	// Requires every variable to be declared with .var, rather than being allocated on first use
+	Strict bool
+
+	// Directories searched for included files, after the directory of the including file
+	IncludePaths []string
+	// Reads included files, which defaults to reading from disk
+	ReadFile func(name string) ([]byte, error)
+
+	// The warnings and statistics from the most recent conversion
+	warnings ErrorList
+	stats    Stats
+	// The source of every file read during the most recent conversion, and the
+	// include directive which first included each file
+	sources      map[string]string
+	includedFrom map[string]token.Span
+	// The macro calls which each expanded instruction came from, innermost first
+	expandedFrom map[ast.Instruction][]*ast.MacroCall
+	// The label written in the source which each label copied by an expansion came from
+	sourceLabels map[*ast.LInstruction]*ast.LInstruction
+	// The number of instructions which each load instruction expands to
+	loads   map[*ast.LoadInstruction]int
+	listing []ListingEntry
+	// The branches of conditionals which were not assembled
+	skipped []token.Span
+}
+
+// A summary of the resources used by an assembled program
+type Stats struct {
+	// The number of instructions output to ROM
+	Instructions int
+	// The number of variables allocated in RAM
+	Variables int
 }
 
 func New() *Assembler {
-	return &Assembler{}
+	enabled := map[string]bool{}
+	for _, warning := range KnownWarnings {
+		enabled[warning.ID] = warning.Enabled
+	}
+
+	return &Assembler{
+		MaxErrors:       parser.DefaultMaxErrors,
+		EnabledWarnings: enabled,
+		ReadFile:        ioutil.ReadFile,
+	}
+}
+
+// The warnings found during the most recent conversion. When warnings are treated
+// as errors, they are returned as errors instead.
+func (a *Assembler) Warnings() ErrorList {
+	return a.warnings
+}
+
+// The statistics from the most recent conversion
+func (a *Assembler) Stats() Stats {
+	return a.stats
+}
+
+// The contents of every file read during the most recent conversion, keyed by file name
+func (a *Assembler) Sources() map[string]string {
+	return a.sources
+}
+
+// The regions of source within conditionals which were skipped during the most recent
+// conversion, in the order they were found. Each region starts at the directive of a
+// branch, and ends at the directive which follows it.
+func (a *Assembler) SkippedRegions() []token.Span {
+	return a.skipped
+}
+
+// Converts the given source into its binary representation. When the source
+// can not be assembled the returned error will be an ErrorList.
+func (a *Assembler) Convert(source string) (string, error) {
+	return a.ConvertFile("", source)
+}
+
+// Converts the given source, reporting any error positions against the given file name.
+// Files included by the source are found relative to the given file.
+func (a *Assembler) ConvertFile(file string, source string) (string, error) {
+	a.warnings = nil
+	a.stats = Stats{}
+	a.listing = nil
+	a.skipped = nil
+	a.sources = map[string]string{file: source}
+	a.includedFrom = map[string]token.Span{}
+	a.expandedFrom = map[ast.Instruction][]*ast.MacroCall{}
+	a.sourceLabels = map[*ast.LInstruction]*ast.LInstruction{}
+
+	binary, errs := a.convert(file, source)
+	a.addIncludeChains(errs)
+	a.addIncludeChains(a.warnings)
+	a.addMacroCalls(errs)
+	a.addMacroCalls(a.warnings)
+	if len(errs) > 0 {
+		a.listing = nil
+		return "", errs
+	}
+
+	return binary, nil
+}
+
+func (a *Assembler) convert(file string, source string) (string, ErrorList) {
+	program, errs := a.parse(file, source)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	includes := a.newIncluder(file, a.newConditionResolver())
+	program, errs = a.expandIncludes(program, includes)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	program, errs = a.expandMacros(program, includes)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	program, errs = a.resolveAliases(program)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	program, errs = a.resolveModules(program)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	st, errs := a.buildSymbolTable(program)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	binary, errs := a.generateBinary(program, st)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	warnings := a.analyze(program, st)
+	if a.WarningsAsErrors && len(warnings) > 0 {
+		for _, warning := range warnings {
+			warning.Severity = ERROR
+		}
+		return "", warnings
+	}
+	a.warnings = warnings
+
+	return binary, nil
 }
 
-func (a *Assembler) Convert(source string) string {
-	l := lexer.New(source)
+func (a *Assembler) parse(file string, source string) (ast.Program, ErrorList) {
+	l := lexer.NewFile(file, source)
 	p := parser.New(l)
+	p.SetMaxErrors(a.MaxErrors)
 	program := p.ParseProgram()
+	program.Instructions = lowerStatements(program.Instructions)
 
-	st := a.buildSymbolTable(program)
-	return a.generateBinary(program, st)
+	return program, a.parseErrors(p.Errors())
+}
+
+// Parse errors caused by characters the lexer did not understand are reported as lex errors
+func (a *Assembler) parseErrors(errors []*parser.Error) ErrorList {
+	var errs ErrorList
+	for _, err := range errors {
+		phase := PARSE
+		if err.Rule == parser.InvalidCharacter {
+			phase = LEX
+		}
+
+		errs = append(errs, &AssemblyError{
+			Rule:    err.Rule,
+			Phase:   phase,
+			Span:    err.Span,
+			Message: err.Message,
+			Help:    err.Help,
+			Notes:   err.Notes,
+		})
+	}
+
+	return errs
 }
 
 // Builds the symbol table containing labels and their corresponding
 // ROM locations, as a first pass from the source file.
-func (a *Assembler) buildSymbolTable(program ast.Program) symboltable.SymbolTable {
+func (a *Assembler) buildSymbolTable(program ast.Program) (symboltable.SymbolTable, ErrorList) {
 	st := symboltable.New()
+	errs := scopeLabels(program)
+	errs = append(errs, a.defineExternalConstants(st)...)
+	a.loads = a.loadSizes(program)
+	definitions := map[string]*ast.LInstruction{}
 
 	// Track the ROM index. This will be incremented for each known instruction that
 	// will be output to ROM
 	romIndex := 0
+	var overflow *AssemblyError
 
 	for _, instruction := range program.Instructions {
 		switch instruction := instruction.(type) {
 		case *ast.LInstruction:
+			if romIndex > generator.MaxValue {
+				errs = append(errs, &AssemblyError{
+					Rule:        LabelOutOfRange,
+					Phase:       RESOLVE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     fmt.Sprintf("label %q is at address %d, which can not be held by an A-instruction", instruction.Value, romIndex),
+					Notes:       []string{fmt.Sprintf("A-instructions can hold 0 to %d", generator.MaxValue)},
+				})
+				continue
+			}
+
+			if symboltable.IsPredefined(instruction.Value) {
+				errs = append(errs, &AssemblyError{
+					Rule:        PredefinedLabel,
+					Phase:       RESOLVE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     fmt.Sprintf("label %q redefines a predefined symbol", instruction.Value),
+					Notes:       []string{fmt.Sprintf("%s is predefined as address %d", instruction.Value, st.Get(instruction.Value))},
+				})
+				continue
+			}
+
+			if st.Contains(instruction.Value) && st.Kind(instruction.Value) == symboltable.CONSTANT {
+				errs = append(errs, &AssemblyError{
+					Rule:        DuplicateLabel,
+					Phase:       RESOLVE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     fmt.Sprintf("label %q is already defined as a constant", instruction.Value),
+				})
+				continue
+			}
+
+			if previous, ok := definitions[instruction.Value]; ok {
+				errs = append(errs, &AssemblyError{
+					Rule:        DuplicateLabel,
+					Phase:       RESOLVE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     fmt.Sprintf("label %q is already defined", instruction.Value),
+					Related: []Related{
+						{Span: nodeSpan(previous), Message: fmt.Sprintf("label %q was first defined here", instruction.Value)},
+					},
+				})
+				continue
+			}
+			definitions[instruction.Value] = instruction
+
 			// Remember that labels do not get output to ROM
-			st.Add(instruction.Value, romIndex)
-		case *ast.AInstruction:
-			romIndex++
-		case *ast.CInstruction:
-			romIndex++
+			st.Add(instruction.Value, symboltable.LABEL, romIndex)
+		case *ast.VarDirective, *ast.ConstantDirective:
+			// Declarations and constants are added once every label is known
+		case *ast.SkippedRegion:
+			// Skipped source is only shown within the listing
+		case *ast.AInstruction, *ast.CInstruction, *ast.LoadInstruction:
+			size := 1
+			if load, ok := instruction.(*ast.LoadInstruction); ok {
+				size = a.loads[load]
+			}
+
+			// Only the first instruction which does not fit is reported, the remainder are counted afterwards
+			if romIndex <= symboltable.ROMSize && romIndex+size > symboltable.ROMSize {
+				overflow = &AssemblyError{
+					Rule:        ROMOverflow,
+					Phase:       RESOLVE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     fmt.Sprintf("program does not fit in ROM, this instruction would be at address %d", romIndex),
+				}
+				errs = append(errs, overflow)
+			}
+			romIndex += size
 		default:
-			panic(fmt.Errorf("unexpected instruction %v", instruction))
+			errs = append(errs, &AssemblyError{
+				Rule:        UnexpectedInstruction,
+				Phase:       RESOLVE,
+				Instruction: instruction,
+				Span:        nodeSpan(instruction),
+				Message:     fmt.Sprintf("unexpected instruction %v", instruction),
+			})
+		}
+	}
+
+	if overflow != nil {
+		overflow.Notes = []string{
+			fmt.Sprintf("the program has %s, but ROM holds %d", count(romIndex, "instruction", "instructions"), symboltable.ROMSize),
+			fmt.Sprintf("the program is %s over budget", count(romIndex-symboltable.ROMSize, "instruction", "instructions")),
 		}
 	}
 
-	return st
+	// Constants may refer to labels, and so are evaluated once every label is known
+	errs = append(errs, a.defineConstants(program, st)...)
+
+	return st, errs
 }
 
 // Generate the corresponding binary representation for a given program and symbol tree.
@@ -57,37 +327,142 @@ func (a *Assembler) buildSymbolTable(program ast.Program) symboltable.SymbolTabl
 // pre-defined symbols, as well as user defined labels.
 //
 // In this second pass, we can now begin to generate the binary representation
-func (a *Assembler) generateBinary(program ast.Program, st symboltable.SymbolTable) string {
+func (a *Assembler) generateBinary(program ast.Program, st symboltable.SymbolTable) (string, ErrorList) {
 	g := generator.New()
 
-	// A point to the next free memory slot for variable assignment
-	// The first 15 slots are taken by 'Registers', therefore the next free slot is 16
-	freeMemorySlotIndex := 16
+	// Declared variables are allocated first, so that their addresses do not depend on where they are used
+	variables, errs := a.declareVariables(program, st)
 
 	var binary []string
 	for _, instruction := range program.Instructions {
-		if _, ok := instruction.(*ast.LInstruction); ok {
-			continue
-		}
+		var code string
+		var err error
+		var notes []string
+		rule := InvalidInstruction
 
 		switch instruction := instruction.(type) {
 		case *ast.LInstruction:
 			// Labels do not get output to ROM, they are pseudo instructions
+			a.listing = append(a.listing, ListingEntry{Address: len(binary), Source: instruction})
+			continue
+		case *ast.VarDirective, *ast.ConstantDirective:
+			// Declarations and constants do not get output to ROM either
+			continue
+		case *ast.SkippedRegion:
+			a.listing = append(a.listing, ListingEntry{Address: len(binary), Source: instruction})
+			continue
+		case *ast.LoadInstruction:
+			if unresolved := a.unresolvedSymbols(instruction, instruction.Value, st); len(unresolved) > 0 {
+				errs = append(errs, unresolved...)
+				continue
+			}
+
+			expansion, codes, err := a.convertLoad(g, instruction, st)
+			if err != nil {
+				loadErr := &AssemblyError{
+					Rule:        InvalidLoad,
+					Phase:       ENCODE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     err.Error(),
+					Help:        "load the value into D, and then assign it with M=D",
+				}
+				if errors.Is(err, generator.ErrOutOfRange) {
+					loadErr.Rule = ValueOutOfRange
+					loadErr.Help = ""
+				}
+				errs = append(errs, loadErr)
+				continue
+			}
+			a.listing = append(a.listing, ListingEntry{
+				Address:      len(binary),
+				Source:       instruction,
+				Instructions: expansion,
+				Binary:       codes,
+			})
+			binary = append(binary, codes...)
+			continue
 		case *ast.AInstruction:
 			variable, isVariable := instruction.Value.(*ast.Variable)
 			if isVariable && !st.Contains(variable.Name) {
+				// Variables generated by the assembler, such as loop counters, need no declaration
+				if a.Strict && !isGeneratedSymbol(variable.Name) {
+					errs = append(errs, undeclaredError(instruction, instruction.Value, variable, st))
+					continue
+				}
 
-				st.Add(variable.Name, freeMemorySlotIndex)
-				freeMemorySlotIndex++
+				if err := variables.allocate(st, instruction, variable.Name); err != nil {
+					errs = append(errs, err)
+				}
+			} else if unresolved := a.unresolvedSymbols(instruction, instruction.Value, st); len(unresolved) > 0 {
+				errs = append(errs, unresolved...)
+				continue
 			}
 
-			binary = append(binary, g.ConvertAInstruction(instruction, st))
+			code, err = g.ConvertAInstruction(instruction, st)
+			if errors.Is(err, generator.ErrOutOfRange) {
+				rule = ValueOutOfRange
+				notes = []string{fmt.Sprintf("A-instructions can hold 0 to %d", generator.MaxValue)}
+			}
 		case *ast.CInstruction:
-			binary = append(binary, g.ConvertCInstruction(instruction))
+			code, err = g.ConvertCInstruction(instruction)
 		default:
-			panic(fmt.Errorf("unexpected instruction %v", instruction))
+			rule = UnexpectedInstruction
+			err = fmt.Errorf("unexpected instruction %v", instruction)
+		}
+
+		if err != nil {
+			errs = append(errs, &AssemblyError{
+				Rule:        rule,
+				Phase:       ENCODE,
+				Instruction: instruction,
+				Span:        nodeSpan(instruction),
+				Message:     err.Error(),
+				Notes:       notes,
+			})
+			continue
+		}
+		a.listing = append(a.listing, ListingEntry{
+			Address:      len(binary),
+			Source:       instruction,
+			Instructions: []ast.Instruction{instruction},
+			Binary:       []string{code},
+		})
+		binary = append(binary, code)
+	}
+
+	variables.summarize()
+	a.stats = Stats{Instructions: len(binary), Variables: variables.allocated + variables.fixed}
+
+	return strings.Join(binary, "\n"), errs
+}
+
+// Converts a load instruction into the real instructions it expands to, along with their binary
+func (a *Assembler) convertLoad(g *generator.Generator, load *ast.LoadInstruction, st symboltable.SymbolTable) ([]ast.Instruction, []string, error) {
+	value, err := generator.Evaluate(load.Value, st)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expansion, err := expandLoad(load, value, a.loads[load])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var codes []string
+	for _, instruction := range expansion {
+		var code string
+		switch instruction := instruction.(type) {
+		case *ast.AInstruction:
+			code, err = g.ConvertAInstruction(instruction, st)
+		case *ast.CInstruction:
+			code, err = g.ConvertCInstruction(instruction)
+		}
+		if err != nil {
+			return nil, nil, err
 		}
+		codes = append(codes, code)
 	}
 
-	return strings.Join(binary, "\n")
+	return expansion, codes, nil
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"github.com/stretchr/testify/assert"
 	"strings"
+	"github.com/alanfoster/assembler/token"
+	"fmt"
 )
 
 func removeWhitespace(s string) string {
@@ -21,7 +23,8 @@ func removeWhitespace(s string) string {
 
 func TestSingleInstruction(t *testing.T) {
 	input := "@3"
-	result := New().Convert(input)
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
 	expected := "0000000000000011"
 
 	assert.Equal(t, expected, result)
@@ -29,7 +32,8 @@ func TestSingleInstruction(t *testing.T) {
 
 func TestMultipleInstructions(t *testing.T) {
 	input := "@3\nD=A\n@3"
-	result := New().Convert(input)
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
 	expected := "0000000000000011\n1110110000010000\n0000000000000011"
 
 	assert.Equal(t, expected, result)
@@ -54,7 +58,8 @@ func TestMaxProgram(t *testing.T) {
 		@14
 		0;JMP
 	`
-	result := New().Convert(input)
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
 	expected := removeWhitespace(`
 		0000000000000000
 		1111110000010000
@@ -85,7 +90,8 @@ func TestProgramWithLabel(t *testing.T) {
 		@LOOP
 		0; JMP
 	`
-	result := New().Convert(input)
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
 	expected := removeWhitespace(`
 		1111110000010000
 		0000000000000000
@@ -109,7 +115,8 @@ func TestProgramWithVariables(t *testing.T) {
 		@i
 		M=0 // i = 0
 	`
-	result := New().Convert(input)
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
 	expected := removeWhitespace(`
 		0000000000000010
 		1110101010001000
@@ -154,7 +161,8 @@ func TestLargerProgramWithVariablesAndLabels(t *testing.T) {
 	   @INFINITE_LOOP
 	   0;JMP
 	`
-	result := New().Convert(input)
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
 	expected := removeWhitespace(`
 		0000000000000000
 		1111110000010000
@@ -185,3 +193,429 @@ func TestLargerProgramWithVariablesAndLabels(t *testing.T) {
 
 	assert.Equal(t, expected, result)
 }
+
+func TestInvalidCharacter(t *testing.T) {
+	input := `
+		@3
+		D=D^M
+	`
+	_, err := New().Convert(input)
+	assert.EqualError(t, err, `3:6: lex error: unexpected character "^"`)
+}
+
+func TestMissingAInstructionValue(t *testing.T) {
+	input := "@"
+	_, err := New().Convert(input)
+	assert.EqualError(t, err, "1:2: parse error: expected a number or symbol, instead got: end of file")
+}
+
+func TestNumberTooLarge(t *testing.T) {
+	input := "@32768"
+	_, err := New().Convert(input)
+	assert.EqualError(t, err, "1:2: parse error: constant 32768 is out of range")
+}
+
+func TestParseErrorsAreCollected(t *testing.T) {
+	input := `
+		@;
+		D=^M
+		(LOOP @LOOP
+		0;JMP
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, PARSE, errs[0].Phase)
+	assert.Equal(t, 2, errs[0].Span.Start.Line)
+	assert.Equal(t, LEX, errs[1].Phase)
+	assert.Equal(t, 3, errs[1].Span.Start.Line)
+	assert.Equal(t, PARSE, errs[2].Phase)
+	assert.Equal(t, 4, errs[2].Span.Start.Line)
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("D=^\n", 10)
+	a := New()
+	a.MaxErrors = 2
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, "too many errors", errs[2].Message)
+}
+
+func TestInvalidMnemonicsAreCollected(t *testing.T) {
+	input := `
+		D=D+D
+		@3
+		DM=M
+		0;JNZ
+	`
+	_, err := New().Convert(input)
+
+	errs, ok := err.(ErrorList)
+	assert.True(t, ok)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, PARSE, errs[0].Phase)
+	assert.Equal(t, `unknown computation "D+D"`, errs[0].Message)
+	assert.Equal(t, `did you mean "D+1"?`, errs[0].Help)
+	assert.Equal(t, `unknown destination "DM"`, errs[1].Message)
+	assert.Equal(t, `did you mean "MD"?`, errs[1].Help)
+	assert.Equal(t, `unknown jump "JNZ"`, errs[2].Message)
+	assert.Equal(t, `did you mean "JNE"?`, errs[2].Help)
+	assert.EqualError(t, err, `2:5: parse error: unknown computation "D+D" (did you mean "D+1"?) (and 2 more errors)`)
+}
+
+func TestErrorPositionsIncludeFileName(t *testing.T) {
+	input := "@3\n  D=D+D"
+	_, err := New().ConvertFile("max.asm", input)
+
+	errs := err.(ErrorList)
+	assert.Equal(t, token.Pos{File: "max.asm", Line: 2, Column: 5, Offset: 7}, errs[0].Span.Start)
+	assert.Equal(t, token.Pos{File: "max.asm", Line: 2, Column: 8, Offset: 10}, errs[0].Span.End)
+	assert.EqualError(t, err, `max.asm:2:5: parse error: unknown computation "D+D" (did you mean "D+1"?)`)
+}
+
+func TestDuplicateLabels(t *testing.T) {
+	input := `
+	(LOOP)
+		@LOOP
+		0;JMP
+	(LOOP)
+		@LOOP
+		0;JMP
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, DuplicateLabel, errs[0].Rule)
+	assert.Equal(t, RESOLVE, errs[0].Phase)
+	assert.Equal(t, `5:2: resolve error: (LOOP): label "LOOP" is already defined`, errs[0].Error())
+	assert.Len(t, errs[0].Related, 1)
+	assert.Equal(t, 2, errs[0].Related[0].Span.Start.Line)
+	assert.Equal(t, `label "LOOP" was first defined here`, errs[0].Related[0].Message)
+}
+
+func TestLabelsRedefiningPredefinedSymbols(t *testing.T) {
+	input := `
+	(R1)
+		@R1
+		0;JMP
+	(SCREEN)
+		@SCREEN
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, PredefinedLabel, errs[0].Rule)
+	assert.Equal(t, `2:2: resolve error: (R1): label "R1" redefines a predefined symbol`, errs[0].Error())
+	assert.Equal(t, []string{"R1 is predefined as address 1"}, errs[0].Notes)
+	assert.Equal(t, []string{"SCREEN is predefined as address 16384"}, errs[1].Notes)
+}
+
+func variables(count int) string {
+	var out strings.Builder
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&out, "@v%d\nM=0\n", i)
+	}
+	return out.String()
+}
+
+func TestVariablesFillingRAM(t *testing.T) {
+	input := variables(0x4000 - 16)
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Instructions: 2 * (0x4000 - 16), Variables: 0x4000 - 16}, a.Stats())
+}
+
+func TestVariablesExhaustingRAM(t *testing.T) {
+	input := variables(0x4000-16+3) + "@v0\nM=0\n"
+	a := New()
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, RAMExhausted, errs[0].Rule)
+	assert.Equal(t, "@v16368", errs[0].Instruction.String())
+	assert.Equal(t, `not enough RAM for variable "v16368", it would be allocated at address 16384 which is the start of the screen`, errs[0].Message)
+	assert.Equal(t, []string{
+		"16368 variables were allocated at addresses 16 to 16383",
+		"3 variables could not be allocated",
+	}, errs[0].Notes)
+	assert.Equal(t, 16368, a.Stats().Variables)
+}
+
+func TestVariableCeiling(t *testing.T) {
+	input := variables(5)
+	a := New()
+	a.VariableCeiling = 20
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, `9:1: resolve error: @v4: not enough RAM for variable "v4", it would be allocated at address 20 which is beyond the variable ceiling`, errs[0].Error())
+	assert.Equal(t, []string{
+		"4 variables were allocated at addresses 16 to 19",
+		"1 variable could not be allocated",
+	}, errs[0].Notes)
+}
+
+func TestVariableCeilingCanNotExceedScreen(t *testing.T) {
+	input := variables(0x4000 - 16 + 1)
+	a := New()
+	a.VariableCeiling = 0x5000
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "which is the start of the screen")
+}
+
+func TestProgramFillingROM(t *testing.T) {
+	input := strings.Repeat("D=0\n", 0x8000)
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0x8000, a.Stats().Instructions)
+}
+
+func TestProgramOverflowingROM(t *testing.T) {
+	input := strings.Repeat("D=0\n", 0x8000) + "(END)\n@END\n0;JMP\n"
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, LabelOutOfRange, errs[0].Rule)
+	assert.Equal(t, `32769:1: resolve error: (END): label "END" is at address 32768, which can not be held by an A-instruction`, errs[0].Error())
+	assert.Equal(t, ROMOverflow, errs[1].Rule)
+	assert.Equal(t, `32770:1: resolve error: @END: program does not fit in ROM, this instruction would be at address 32768`, errs[1].Error())
+	assert.Equal(t, []string{
+		"the program has 32770 instructions, but ROM holds 32768",
+		"the program is 2 instructions over budget",
+	}, errs[1].Notes)
+}
+
+func TestLabelAfterLastROMAddress(t *testing.T) {
+	input := "@END\n" + strings.Repeat("D=0\n", 0x8000-1) + "(END)\n"
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, LabelOutOfRange, errs[0].Rule)
+	assert.Equal(t, []string{"A-instructions can hold 0 to 32767"}, errs[0].Notes)
+}
+
+func TestDeclaredVariables(t *testing.T) {
+	input := `
+		.var fixed 16
+		@implicit
+		M=0
+		@declared
+		M=0
+		@fixed
+		M=0
+		.var declared
+	`
+	a := New()
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000010010
+		1110101010001000
+		0000000000010001
+		1110101010001000
+		0000000000010000
+		1110101010001000
+	`), result)
+	assert.Equal(t, 3, a.Stats().Variables)
+}
+
+func TestStrictModeRequiresDeclarations(t *testing.T) {
+	input := `
+		.var counter
+	(LOOP)
+		@counter
+		M=M+1
+		@countr
+		M=0
+		@LOOP
+		0;JMP
+	`
+	a := New()
+	a.Strict = true
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, UndeclaredSymbol, errs[0].Rule)
+	assert.Equal(t, `6:3: resolve error: @countr: symbol "countr" is not declared (did you mean "counter"?)`, errs[0].Error())
+	assert.Equal(t, []string{`variables must be declared with ".var countr" in strict mode`}, errs[0].Notes)
+}
+
+func TestStrictModeAllowsLabelsAndPredefinedSymbols(t *testing.T) {
+	input := `
+	(LOOP)
+		@SCREEN
+		M=-1
+		@LOOP
+		0;JMP
+	`
+	a := New()
+	a.Strict = true
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+}
+
+func TestInvalidDeclarations(t *testing.T) {
+	input := `
+	(LOOP)
+		.var LOOP
+		.var SP
+		.var x 20
+		.var x
+		.var y 20
+		@LOOP
+		0;JMP
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 4)
+	assert.Equal(t, `3:3: resolve error: .var LOOP: variable "LOOP" is already defined as a label`, errs[0].Error())
+	assert.Equal(t, PredefinedVariable, errs[1].Rule)
+	assert.Equal(t, DuplicateVariable, errs[2].Rule)
+	assert.Equal(t, 5, errs[2].Related[0].Span.Start.Line)
+	assert.Equal(t, `7:3: resolve error: .var y 20: variable "y" shares address 20 with variable "x"`, errs[3].Error())
+}
+
+func TestDeclaredVariablesExhaustingRAM(t *testing.T) {
+	input := ".var a\n.var b\n.var c\n@a\n@b\n@c\n"
+	a := New()
+	a.VariableCeiling = 18
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, `3:1: resolve error: .var c: not enough RAM for variable "c", it would be allocated at address 18 which is beyond the variable ceiling`, errs[0].Error())
+}
+
+func TestDeclaredVariablesAtFixedAddressesOutsideRAM(t *testing.T) {
+	input := ".var pixels 16384\n.var key 24576\n.var past 24577\n.var high 100\n@pixels\n@key\n@past\n@high\n"
+	a := New()
+	a.VariableCeiling = 100
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 4)
+	assert.Equal(t, VariableAddressOutOfRange, errs[0].Rule)
+	assert.Equal(t, `1:1: resolve error: .var pixels 16384: variable "pixels" is at address 16384, which is within the memory mapped screen`, errs[0].Error())
+	assert.Equal(t, `variable "key" is at address 24576, which is the memory mapped keyboard`, errs[1].Message)
+	assert.Equal(t, `variable "past" is at address 24577, which is beyond the end of RAM`, errs[2].Message)
+	assert.Equal(t, `variable "high" is at address 100, which is beyond the variable ceiling of 100`, errs[3].Message)
+	assert.Equal(t, []string{"variables can use addresses 0 to 99"}, errs[3].Notes)
+}
+
+func TestLiteralsAndKeyCodes(t *testing.T) {
+	input := `
+		@KBD
+		D=M
+		@KEY_UP
+		D=D-A
+		@0x4000
+		@'a'
+		@KEY_F12
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0110000000000000
+		1111110000010000
+		0000000010000011
+		1110010011010000
+		0100000000000000
+		0000000001100001
+		0000000010011000
+	`), result)
+}
+
+func TestConstantExpressions(t *testing.T) {
+	input := `
+		@i
+		M=0
+	(TABLE)
+		@SCREEN+32
+		D=A
+		@TABLE+3
+		@i+1
+		@(KBD-SCREEN)/2-1
+		@'a'-'A'
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000010000
+		1110101010001000
+		0100000000100000
+		1110110000010000
+		0000000000000101
+		0000000000010001
+		0000111111111111
+		0000000000100000
+	`), result)
+}
+
+func TestExpressionsReferencingUnallocatedVariables(t *testing.T) {
+	input := `
+		@counter+1
+		D=A
+		@counter
+		M=D
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, UnallocatedVariable, errs[0].Rule)
+	assert.Equal(t, `2:4: resolve error: @counter+1: expression uses variable "counter" before it has been allocated (declare the variable with ".var counter")`, errs[0].Error())
+}
+
+func TestExpressionsOutOfRange(t *testing.T) {
+	input := `
+		@SCREEN*2
+		@R1-2
+		@1/0
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, ValueOutOfRange, errs[0].Rule)
+	assert.Equal(t, `2:3: encode error: @SCREEN*2: value 32768 is out of range`, errs[0].Error())
+	assert.Equal(t, []string{"A-instructions can hold 0 to 32767"}, errs[0].Notes)
+	assert.Equal(t, ValueOutOfRange, errs[1].Rule)
+	assert.Equal(t, InvalidInstruction, errs[2].Rule)
+	assert.Equal(t, "division by zero", errs[2].Message)
+}
+
+func TestExpressionsCountAsLabelReferences(t *testing.T) {
+	input := `
+	(TABLE)
+		@TABLE+1
+		D=M
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Empty(t, a.Warnings())
+}
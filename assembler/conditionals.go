@@ -0,0 +1,155 @@
+package assembler
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/generator"
+	"github.com/alanfoster/assembler/symboltable"
+	"github.com/alanfoster/assembler/token"
+)
+
+// Chooses the branch of each conditional to assemble. Conditions are evaluated in source
+// order, before labels are placed, and so can only use the constants defined before them.
+type conditionResolver struct {
+	a *Assembler
+	// Predefined symbols, external constants, and each constant evaluated by a condition so far
+	st symboltable.SymbolTable
+	// The constants defined so far, which are only evaluated when a condition needs them
+	constants map[string]*ast.ConstantDirective
+	skipped   map[token.Span]bool
+}
+
+func (a *Assembler) newConditionResolver() *conditionResolver {
+	st := symboltable.New()
+	// Invalid external constants are reported once labels are placed
+	a.defineExternalConstants(st)
+
+	return &conditionResolver{
+		a:         a,
+		st:        st,
+		constants: map[string]*ast.ConstantDirective{},
+		skipped:   map[token.Span]bool{},
+	}
+}
+
+// Records a constant as defined for any later condition. Duplicate constants are
+// reported once labels are placed, so only the first definition is used.
+func (c *conditionResolver) define(constant *ast.ConstantDirective) {
+	if _, ok := c.constants[constant.Name]; !ok {
+		c.constants[constant.Name] = constant
+	}
+}
+
+// The body of the branch to assemble, which has no instructions when no condition holds.
+// Every other branch is replaced by the region of source which was skipped.
+func (c *conditionResolver) choose(conditional *ast.ConditionalDirective) ([]ast.Instruction, *AssemblyError) {
+	var chosen *ast.ConditionalBranch
+	for _, branch := range conditional.Branches {
+		if chosen != nil {
+			break
+		}
+
+		holds, err := c.holds(conditional, branch)
+		if err != nil {
+			return nil, err
+		}
+		if holds {
+			chosen = branch
+		}
+	}
+
+	var body []ast.Instruction
+	for _, branch := range conditional.Branches {
+		if branch == chosen {
+			body = append(body, branch.Body...)
+		} else {
+			body = append(body, c.skip(branch))
+		}
+	}
+
+	return body, nil
+}
+
+func (c *conditionResolver) skip(branch *ast.ConditionalBranch) *ast.SkippedRegion {
+	if !c.skipped[branch.Region] {
+		c.skipped[branch.Region] = true
+		c.a.skipped = append(c.a.skipped, branch.Region)
+	}
+
+	return &ast.SkippedRegion{Span: branch.Region}
+}
+
+func (c *conditionResolver) holds(conditional *ast.ConditionalDirective, branch *ast.ConditionalBranch) (bool, *AssemblyError) {
+	switch branch.Directive {
+	case ".else":
+		return true, nil
+	case ".ifdef", ".ifndef":
+		name := branch.Condition.(*ast.Variable).Name
+		_, defined := c.constants[name]
+		defined = defined || c.st.Contains(name)
+		return defined == (branch.Directive == ".ifdef"), nil
+	}
+
+	value, err := c.evaluate(conditional, branch.Condition, InvalidCondition, "condition")
+	return value != 0, err
+}
+
+// Evaluates a value which is needed before labels are placed, such as a condition. Any
+// error is reported with the given rule, and describes the value as what.
+func (c *conditionResolver) evaluate(instruction ast.Instruction, expression ast.AInstructionValue, rule string, what string) (int, *AssemblyError) {
+	for _, variable := range ast.Variables(expression) {
+		constant, ok := c.constants[variable.Name]
+		if !ok || c.st.Contains(variable.Name) {
+			continue
+		}
+
+		// Evaluated afresh each time, as a constant may depend on constants defined since
+		r := &constantResolver{
+			st:        c.st,
+			constants: c.constants,
+			resolving: map[string]bool{},
+			failed:    map[string]bool{},
+		}
+		if !r.resolve(constant) {
+			err := &AssemblyError{
+				Rule:        rule,
+				Phase:       EXPAND,
+				Instruction: instruction,
+				Span:        nodeSpan(expression),
+				Message:     fmt.Sprintf("%s depends on constant %q, which can not be evaluated yet", what, variable.Name),
+				Related: []Related{
+					{Span: nodeSpan(constant), Message: fmt.Sprintf("constant %q is defined here", variable.Name)},
+				},
+			}
+			for _, reason := range r.errs {
+				err.Notes = append(err.Notes, reason.Message)
+			}
+			return 0, err
+		}
+	}
+
+	value, err := generator.Evaluate(expression, c.st)
+	if err != nil {
+		return 0, &AssemblyError{
+			Rule:        rule,
+			Phase:       EXPAND,
+			Instruction: instruction,
+			Span:        nodeSpan(expression),
+			Message:     fmt.Sprintf("%s in %s", err, what),
+			Notes:       []string{fmt.Sprintf("a %s can only refer to predefined symbols, constants defined before it, and constants given with -D", what)},
+		}
+	}
+
+	return value, nil
+}
+
+func errorDirectiveError(directive *ast.ErrorDirective) *AssemblyError {
+	return &AssemblyError{
+		Rule:        ErrorDirective,
+		Phase:       EXPAND,
+		Instruction: directive,
+		Span:        nodeSpan(directive),
+		Message:     directive.Message,
+	}
+}
@@ -0,0 +1,182 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alanfoster/assembler/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionals(t *testing.T) {
+	input := `
+	.define MODE 2
+	.if MODE == 1
+		@1
+	.elif MODE == 2
+		.ifdef VERBOSE
+			@2
+		.else
+			@3
+		.endif
+	.else
+		@4
+	.endif
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000011
+	`), result)
+}
+
+func TestConditionalsUseExternalConstants(t *testing.T) {
+	input := `
+	.ifdef VERBOSE
+		@VERBOSE
+	.endif
+	.ifndef VERBOSE
+		@0
+	.endif
+	`
+	a := New()
+	a.Constants = map[string]int{"VERBOSE": 5}
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000101
+	`), result)
+}
+
+func TestConditionalsOnlySeeEarlierConstants(t *testing.T) {
+	input := `
+	.ifdef LATER
+		@1
+	.endif
+	.equ LATER 1
+	.ifdef LATER
+		@2
+	.endif
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000010
+	`), result)
+}
+
+func TestSkippedRegions(t *testing.T) {
+	input := ".if 0\n@1\n.elif 1\n@2\n.else\n@3\n.endif"
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []token.Span{
+		{Start: token.Pos{Line: 1, Column: 1, Offset: 0}, End: token.Pos{Line: 3, Column: 1, Offset: 9}},
+		{Start: token.Pos{Line: 5, Column: 1, Offset: 20}, End: token.Pos{Line: 7, Column: 1, Offset: 29}},
+	}, a.SkippedRegions())
+}
+
+func TestSkippedRegionsInListing(t *testing.T) {
+	input := ".if 0\n@1\nD=A\n.elif 1\n@2\n.else\n@3\n.endif"
+	a := New()
+	_, err := a.Convert(input)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteListing(&out, a.Listing()))
+	assert.Equal(t, ""+
+		"                         // lines 1 to 3 skipped\n"+
+		"    0  0000000000000010  @2\n"+
+		"                         // lines 6 to 7 skipped\n", out.String())
+}
+
+func TestSkippedBranchesAreNotIncluded(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"guarded.asm": ".ifndef GUARDED\n.define GUARDED 1\n@7\n.endif\n",
+	})
+	input := ".include \"guarded.asm\"\n.if 0\n.include \"missing.asm\"\n.endif\n.include \"guarded.asm\""
+	result, err := a.ConvertFile("main.asm", input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000111
+	`), result)
+}
+
+func TestConditionalsWithinMacros(t *testing.T) {
+	input := `
+	.macro LOAD VALUE
+	.if VALUE < 0
+		D=#VALUE
+	.else
+		@VALUE
+		D=A
+	.endif
+	.endm
+		LOAD 2
+		LOAD (-1)
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000010
+		1110110000010000
+		1110111010010000
+	`), result)
+}
+
+func TestConditionalErrors(t *testing.T) {
+	input := `
+	.equ START LOOP
+	.if START
+	.endif
+	.if MISSING
+	.endif
+	.if 1
+		.error "unsupported mode"
+	.else
+		.error "not reported"
+	.endif
+	(LOOP)
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+
+	assert.Equal(t, InvalidCondition, errs[0].Rule)
+	assert.Equal(t, `condition depends on constant "START", which can not be evaluated yet`, errs[0].Message)
+	assert.Equal(t, []string{`undefined symbol "LOOP" in constant "START"`}, errs[0].Notes)
+	assert.Equal(t, 2, errs[0].Related[0].Span.Start.Line)
+
+	assert.Equal(t, InvalidCondition, errs[1].Rule)
+	assert.Equal(t, `undefined symbol "MISSING" in condition`, errs[1].Message)
+
+	assert.Equal(t, ErrorDirective, errs[2].Rule)
+	assert.Equal(t, EXPAND, errs[2].Phase)
+	assert.Equal(t, "unsupported mode", errs[2].Message)
+	assert.Equal(t, 8, errs[2].Span.Start.Line)
+}
+
+func TestErrorDirectiveWithinMacro(t *testing.T) {
+	input := `
+	.macro CHECK VALUE
+	.if VALUE > 10
+		.error "value is too large"
+	.endif
+	.endm
+		CHECK 1
+		CHECK 11
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "value is too large", errs[0].Message)
+	assert.Equal(t, 8, errs[0].Related[0].Span.Start.Line)
+}
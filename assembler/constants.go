@@ -0,0 +1,188 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/generator"
+	"github.com/alanfoster/assembler/parser"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// Adds the constants defined outside of the source, which are available to every constant within it
+func (a *Assembler) defineExternalConstants(st symboltable.SymbolTable) ErrorList {
+	var names []string
+	for name := range a.Constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs ErrorList
+	for _, name := range names {
+		if symboltable.IsPredefined(name) {
+			errs = append(errs, &AssemblyError{
+				Rule:    PredefinedConstant,
+				Phase:   RESOLVE,
+				Message: fmt.Sprintf("constant %q redefines a predefined symbol", name),
+			})
+			continue
+		}
+		if parser.IsRegisters(name) {
+			errs = append(errs, &AssemblyError{
+				Rule:    parser.InvalidSymbolName,
+				Phase:   RESOLVE,
+				Message: fmt.Sprintf("constant %q would be read as a register, as it is made only of A, D and M", name),
+				Help:    "give the constant a name which is not made only of A, D and M",
+			})
+			continue
+		}
+
+		st.Add(name, symboltable.CONSTANT, a.Constants[name])
+	}
+
+	return errs
+}
+
+// Evaluates each .equ and .define directive, adding the result to the symbol table.
+// Constants may refer to labels, predefined symbols, and other constants defined
+// anywhere within the program, but not to variables as they are yet to be allocated.
+func (a *Assembler) defineConstants(program ast.Program, st symboltable.SymbolTable) ErrorList {
+	r := &constantResolver{
+		st:        st,
+		constants: map[string]*ast.ConstantDirective{},
+		resolving: map[string]bool{},
+		failed:    map[string]bool{},
+	}
+	var order []*ast.ConstantDirective
+
+	for _, instruction := range program.Instructions {
+		constant, ok := instruction.(*ast.ConstantDirective)
+		if !ok {
+			continue
+		}
+
+		if symboltable.IsPredefined(constant.Name) {
+			r.errs = append(r.errs, &AssemblyError{
+				Rule:        PredefinedConstant,
+				Phase:       RESOLVE,
+				Instruction: constant,
+				Span:        nodeSpan(constant),
+				Message:     fmt.Sprintf("constant %q redefines a predefined symbol", constant.Name),
+				Notes:       []string{fmt.Sprintf("%s is predefined as address %d", constant.Name, st.Get(constant.Name))},
+			})
+			continue
+		}
+
+		if previous, ok := r.constants[constant.Name]; ok {
+			r.errs = append(r.errs, &AssemblyError{
+				Rule:        DuplicateConstant,
+				Phase:       RESOLVE,
+				Instruction: constant,
+				Span:        nodeSpan(constant),
+				Message:     fmt.Sprintf("constant %q is already defined", constant.Name),
+				Related: []Related{
+					{Span: nodeSpan(previous), Message: fmt.Sprintf("constant %q was first defined here", constant.Name)},
+				},
+			})
+			continue
+		}
+
+		if value, ok := a.Constants[constant.Name]; ok {
+			r.errs = append(r.errs, &AssemblyError{
+				Rule:        DuplicateConstant,
+				Phase:       RESOLVE,
+				Instruction: constant,
+				Span:        nodeSpan(constant),
+				Message:     fmt.Sprintf("constant %q is already defined on the command line", constant.Name),
+				Notes:       []string{fmt.Sprintf("it was defined with -D %s=%d", constant.Name, value)},
+			})
+			continue
+		}
+
+		if st.Contains(constant.Name) {
+			r.errs = append(r.errs, &AssemblyError{
+				Rule:        DuplicateConstant,
+				Phase:       RESOLVE,
+				Instruction: constant,
+				Span:        nodeSpan(constant),
+				Message:     fmt.Sprintf("constant %q is already defined as a %s", constant.Name, st.Kind(constant.Name)),
+			})
+			continue
+		}
+
+		r.constants[constant.Name] = constant
+		order = append(order, constant)
+	}
+
+	for _, constant := range order {
+		r.resolve(constant)
+	}
+
+	return r.errs
+}
+
+// Evaluates constants in the order they are needed, so that a constant may refer to one defined after it
+type constantResolver struct {
+	st        symboltable.SymbolTable
+	constants map[string]*ast.ConstantDirective
+	// Constants which are currently being evaluated, used to detect constants which depend on themselves
+	resolving map[string]bool
+	failed    map[string]bool
+	errs      ErrorList
+}
+
+// Evaluates the given constant and adds it to the symbol table, reporting whether it was successful
+func (r *constantResolver) resolve(constant *ast.ConstantDirective) bool {
+	if r.failed[constant.Name] {
+		return false
+	}
+	if r.st.Contains(constant.Name) {
+		return true
+	}
+
+	if r.resolving[constant.Name] {
+		r.failed[constant.Name] = true
+		r.errs = append(r.errs, &AssemblyError{
+			Rule:        InvalidConstant,
+			Phase:       RESOLVE,
+			Instruction: constant,
+			Span:        nodeSpan(constant),
+			Message:     fmt.Sprintf("constant %q depends on itself", constant.Name),
+		})
+		return false
+	}
+
+	r.resolving[constant.Name] = true
+	defer delete(r.resolving, constant.Name)
+
+	for _, variable := range ast.Variables(constant.Value) {
+		dependency, ok := r.constants[variable.Name]
+		if ok && !r.resolve(dependency) {
+			r.failed[constant.Name] = true
+			return false
+		}
+	}
+
+	value, err := generator.Evaluate(constant.Value, r.st)
+	if err != nil {
+		r.failed[constant.Name] = true
+		invalid := &AssemblyError{
+			Rule:        InvalidConstant,
+			Phase:       RESOLVE,
+			Instruction: constant,
+			Span:        nodeSpan(constant.Value),
+			Message:     fmt.Sprintf("%s in constant %q", err, constant.Name),
+		}
+		// Variables are yet to be allocated, which explains why a symbol may be undefined
+		if errors.Is(err, generator.ErrUndefinedSymbol) {
+			invalid.Notes = []string{"constants can only refer to labels, predefined symbols and other constants"}
+		}
+		r.errs = append(r.errs, invalid)
+		return false
+	}
+
+	r.st.Add(constant.Name, symboltable.CONSTANT, value)
+	return true
+}
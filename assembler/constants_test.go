@@ -0,0 +1,187 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/alanfoster/assembler/lexer"
+	"github.com/alanfoster/assembler/parser"
+	"github.com/alanfoster/assembler/symboltable"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstants(t *testing.T) {
+	input := `
+		.equ WIDTH 512
+		.define LAST_ROW ROWS-1
+		.equ ROWS 256
+		.equ END_OF_TABLE TABLE+2
+		@WIDTH
+		D=A
+		@LAST_ROW*32
+	(TABLE)
+		@END_OF_TABLE
+		0;JMP
+	`
+	a := New()
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000001000000000
+		1110110000010000
+		0001111111100000
+		0000000000000101
+		1110101010000111
+	`), result)
+	assert.Equal(t, 0, a.Stats().Variables)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestExternalConstants(t *testing.T) {
+	input := `
+		.equ HALF WIDTH/2
+		@HALF
+	`
+	a := New()
+	a.Constants = map[string]int{"WIDTH": 512}
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "0000000100000000", result)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestConstantsLargerThanAnAInstruction(t *testing.T) {
+	input := `
+	.equ MASK 0xFFFF
+		@MASK>>1
+		@(0x8000>>1)
+		@MASK
+	`
+	result, err := New().Convert(input)
+
+	assert.Empty(t, result)
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ValueOutOfRange, errs[0].Rule)
+	assert.Equal(t, `5:3: encode error: @MASK: value 65535 is out of range`, errs[0].Error())
+
+	result, err = New().Convert(".equ MASK 0xFFFF\n@MASK>>1\n@(0x8000>>1)")
+	assert.NoError(t, err)
+	assert.Equal(t, "0111111111111111\n0100000000000000", result)
+}
+
+func TestConstantsInStrictMode(t *testing.T) {
+	a := New()
+	a.Strict = true
+	_, err := a.Convert(".equ WIDTH 512\n@WIDTH")
+
+	assert.NoError(t, err)
+}
+
+func TestInvalidConstants(t *testing.T) {
+	input := `
+	(LOOP)
+		.equ LOOP 1
+		.equ KBD 1
+		.equ A1 B1
+		.equ B1 A1
+		.equ C1 x+1
+		.equ D1 1/0
+		.equ D1 2
+		@LOOP
+		0;JMP
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Equal(t, []string{
+		`3:3: resolve error: .equ LOOP 1: constant "LOOP" is already defined as a label`,
+		`4:3: resolve error: .equ KBD 1: constant "KBD" redefines a predefined symbol`,
+		`9:3: resolve error: .equ D1 2: constant "D1" is already defined`,
+		`5:3: resolve error: .equ A1 B1: constant "A1" depends on itself`,
+		`7:11: resolve error: .equ C1 x+1: undefined symbol "x" in constant "C1"`,
+		`8:11: resolve error: .equ D1 1/0: division by zero in constant "D1"`,
+	}, messages(errs))
+	assert.Equal(t, DuplicateConstant, errs[0].Rule)
+	assert.Equal(t, PredefinedConstant, errs[1].Rule)
+	assert.Equal(t, InvalidConstant, errs[3].Rule)
+}
+
+func TestConstantsCanNotBeRedefinedAsLabels(t *testing.T) {
+	input := `
+	(HEIGHT)
+		@0
+	`
+	a := New()
+	a.Constants = map[string]int{"HEIGHT": 2, "SP": 3}
+	_, err := a.Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Equal(t, []string{
+		`resolve error: constant "SP" redefines a predefined symbol`,
+		`2:2: resolve error: (HEIGHT): label "HEIGHT" is already defined as a constant`,
+	}, messages(errs))
+}
+
+func TestExternalConstantsNamedAfterRegisters(t *testing.T) {
+	a := New()
+	a.Constants = map[string]int{"D": 5}
+	_, err := a.Convert("@D")
+
+	assert.EqualError(t, err, `resolve error: constant "D" would be read as a register, as it is made only of A, D and M (give the constant a name which is not made only of A, D and M)`)
+}
+
+func TestConstantsCanNotBeRedefinedFromTheCommandLine(t *testing.T) {
+	a := New()
+	a.Constants = map[string]int{"WIDTH": 3}
+	_, err := a.Convert(".equ WIDTH 512")
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, DuplicateConstant, errs[0].Rule)
+	assert.Equal(t, `constant "WIDTH" is already defined on the command line`, errs[0].Message)
+	assert.Equal(t, []string{"it was defined with -D WIDTH=3"}, errs[0].Notes)
+}
+
+func TestOnlyUndefinedSymbolsInConstantsAreExplained(t *testing.T) {
+	_, err := New().Convert(".equ A1 x+1\n.equ B1 1<<-1")
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, []string{"constants can only refer to labels, predefined symbols and other constants"}, errs[0].Notes)
+	assert.Equal(t, `negative shift amount -1 in constant "B1"`, errs[1].Message)
+	assert.Empty(t, errs[1].Notes)
+}
+
+func TestConstantsCanNotBeRedefinedAsVariables(t *testing.T) {
+	_, err := New().Convert(".equ WIDTH 1\n.var WIDTH")
+
+	assert.EqualError(t, err, `2:1: resolve error: .var WIDTH: variable "WIDTH" is already defined as a constant`)
+}
+
+func TestMisspelledConstants(t *testing.T) {
+	input := `
+		.equ WIDTH 512
+		@WIDHT
+		D=A
+		@WIDTH
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`3:3: analyze warning: @WIDHT: variable "WIDHT" is similar to the constant "WIDTH" (did you mean "WIDTH"?)`,
+	}, messages(a.Warnings()))
+}
+
+func TestConstantKind(t *testing.T) {
+	p := parser.New(lexer.New(".equ TEN 10"))
+	program := p.ParseProgram()
+	st := symboltable.New()
+	errs := New().defineConstants(program, st)
+
+	assert.Empty(t, errs)
+	assert.Equal(t, symboltable.Symbol{Value: 10, Kind: symboltable.CONSTANT}, st["TEN"])
+}
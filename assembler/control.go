@@ -0,0 +1,196 @@
+package assembler
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/generator"
+	"github.com/alanfoster/assembler/token"
+)
+
+// The jump taken when the result of a computation compares with 0 using each operator
+var comparisonJumps = map[string]string{
+	"<":  "JLT",
+	"<=": "JLE",
+	">":  "JGT",
+	">=": "JGE",
+	"==": "JEQ",
+	"!=": "JNE",
+}
+
+// Replaces each runtime statement, such as .while D!=0, with the real instructions which
+// implement it. This happens straight after parsing, so that later stages only see real
+// instructions. Labels are named after the position of their statement, which is unique
+// within the program, and are renamed for each expansion like any other label in a macro.
+func lowerStatements(instructions []ast.Instruction) []ast.Instruction {
+	var lowered []ast.Instruction
+	for _, instruction := range instructions {
+		switch instruction := instruction.(type) {
+		case *ast.IfStatement:
+			lowered = append(lowered, lowerIf(instruction)...)
+			continue
+		case *ast.WhileStatement:
+			lowered = append(lowered, lowerWhile(instruction)...)
+			continue
+		case *ast.LoopStatement:
+			lowered = append(lowered, lowerLoop(instruction)...)
+			continue
+		case *ast.ConditionalDirective:
+			for _, branch := range instruction.Branches {
+				branch.Body = lowerStatements(branch.Body)
+			}
+		case *ast.MacroDefinition:
+			instruction.Body = lowerStatements(instruction.Body)
+		case *ast.RepeatDirective:
+			instruction.Body = lowerStatements(instruction.Body)
+		case *ast.IterateDirective:
+			instruction.Body = lowerStatements(instruction.Body)
+		}
+
+		lowered = append(lowered, instruction)
+	}
+
+	return lowered
+}
+
+// Each condition jumps past its branch when it does not hold:
+//
+//	    @IF.1
+//	    comp;INVERSE   // when the .if condition does not hold
+//	    body
+//	    @IF.end
+//	    0;JMP
+//	(IF.1)
+//	    ...            // each .elif in the same way
+//	    body           // .else
+//	(IF.end)
+func lowerIf(statement *ast.IfStatement) []ast.Instruction {
+	name := generatedName("if", statement.Span)
+	end := name + ".end"
+
+	var lowered []ast.Instruction
+	for index, branch := range statement.Branches {
+		last := index == len(statement.Branches)-1
+		next := end
+		if !last {
+			next = fmt.Sprintf("%s.%d", name, index+1)
+		}
+
+		if condition, ok := branch.Condition.(*ast.RuntimeCondition); ok {
+			lowered = append(lowered, jumpUnless(condition, next)...)
+		}
+		lowered = append(lowered, lowerStatements(branch.Body)...)
+		if !last {
+			lowered = append(lowered, jumpTo(end, branch.Span)...)
+			lowered = append(lowered, labelNamed(next, branch.Span))
+		}
+	}
+
+	return append(lowered, labelNamed(end, statement.Span))
+}
+
+// The condition is checked before each iteration:
+//
+//	(WHILE)
+//	    @WHILE.end
+//	    comp;INVERSE
+//	    body
+//	    @WHILE
+//	    0;JMP
+//	(WHILE.end)
+func lowerWhile(statement *ast.WhileStatement) []ast.Instruction {
+	name := generatedName("while", statement.Span)
+	end := name + ".end"
+
+	lowered := []ast.Instruction{labelNamed(name, statement.Span)}
+	lowered = append(lowered, jumpUnless(statement.Condition, end)...)
+	lowered = append(lowered, lowerStatements(statement.Body)...)
+	lowered = append(lowered, jumpTo(name, statement.Closing)...)
+	return append(lowered, labelNamed(end, statement.Closing))
+}
+
+// The count is held in a variable, rather than a register, so that the body may use any register
+//
+//	    @count
+//	    D=A
+//	    @LOOP.count
+//	    M=D
+//	(LOOP)
+//	    @LOOP.count
+//	    D=M
+//	    @LOOP.end
+//	    D;JLE
+//	    body
+//	    @LOOP.count
+//	    M=M-1
+//	    @LOOP
+//	    0;JMP
+//	(LOOP.end)
+func lowerLoop(statement *ast.LoopStatement) []ast.Instruction {
+	name := generatedName("loop", statement.Span)
+	counter := name + ".count"
+	end := name + ".end"
+	span := statement.Span
+
+	lowered := []ast.Instruction{
+		&ast.AInstruction{Value: statement.Count, Span: span},
+		cInstruction("D", "A", "", span),
+		addressOf(counter, span),
+		cInstruction("M", "D", "", span),
+		labelNamed(name, span),
+		addressOf(counter, span),
+		cInstruction("D", "M", "", span),
+		addressOf(end, span),
+		cInstruction("", "D", "JLE", span),
+	}
+	lowered = append(lowered, lowerStatements(statement.Body)...)
+
+	span = statement.Closing
+	lowered = append(lowered, addressOf(counter, span), cInstruction("M", "M-1", "", span))
+	lowered = append(lowered, jumpTo(name, span)...)
+	return append(lowered, labelNamed(end, span))
+}
+
+// Statements are named after their position, such as while#main.asm:3:1
+func generatedName(kind string, span token.Span) string {
+	return fmt.Sprintf("%s#%s", kind, span.Start)
+}
+
+// Jumps to the label when the condition does not hold
+func jumpUnless(condition *ast.RuntimeCondition, name string) []ast.Instruction {
+	inverse, _ := generator.InverseJump(comparisonJumps[condition.Operator])
+
+	return []ast.Instruction{
+		addressOf(name, condition.Span),
+		&ast.CInstruction{
+			Command: condition.Computation,
+			Jump:    &ast.Value{Value: inverse, Span: condition.Span},
+			Span:    condition.Span,
+		},
+	}
+}
+
+func jumpTo(name string, span token.Span) []ast.Instruction {
+	return []ast.Instruction{addressOf(name, span), cInstruction("", "0", "JMP", span)}
+}
+
+func addressOf(name string, span token.Span) *ast.AInstruction {
+	return &ast.AInstruction{Value: &ast.Variable{Name: name, Span: span}, Span: span}
+}
+
+func labelNamed(name string, span token.Span) *ast.LInstruction {
+	return &ast.LInstruction{Value: name, Span: span}
+}
+
+// A C-instruction, where the destination and jump are optional
+func cInstruction(dest string, comp string, jump string, span token.Span) *ast.CInstruction {
+	instruction := &ast.CInstruction{Command: ast.Command{Value: comp, Span: span}, Span: span}
+	if dest != "" {
+		instruction.Destination = &ast.Value{Value: dest, Span: span}
+	}
+	if jump != "" {
+		instruction.Jump = &ast.Value{Value: jump, Span: span}
+	}
+
+	return instruction
+}
@@ -0,0 +1,208 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs an assembled program on a simulated Hack CPU until it reaches the end of ROM,
+// returning the final value of D and of RAM
+func run(t *testing.T, binary string, ram map[int]int) (int, map[int]int) {
+	rom := strings.Split(binary, "\n")
+	memory := map[int]int{}
+	for address, value := range ram {
+		memory[address] = value & 0xFFFF
+	}
+
+	var a, d, pc int
+	for steps := 0; pc < len(rom); steps++ {
+		if steps > 10000 {
+			t.Fatalf("program did not finish")
+		}
+
+		word, err := strconv.ParseInt(rom[pc], 2, 32)
+		assert.NoError(t, err)
+		instruction := int(word)
+		pc++
+
+		if instruction&0x8000 == 0 {
+			a = instruction
+			continue
+		}
+
+		// The ALU, which computes from D and either A or M
+		x, y := d, a
+		if instruction&0x1000 != 0 {
+			y = memory[a]
+		}
+		bit := func(n uint) bool { return instruction&(1<<n) != 0 }
+		if bit(11) {
+			x = 0
+		}
+		if bit(10) {
+			x = ^x & 0xFFFF
+		}
+		if bit(9) {
+			y = 0
+		}
+		if bit(8) {
+			y = ^y & 0xFFFF
+		}
+		out := x & y
+		if bit(7) {
+			out = (x + y) & 0xFFFF
+		}
+		if bit(6) {
+			out = ^out & 0xFFFF
+		}
+
+		target := a
+		if bit(3) {
+			memory[a] = out
+		}
+		if bit(4) {
+			d = out
+		}
+		if bit(5) {
+			a = out
+		}
+
+		negative, zero := out&0x8000 != 0, out == 0
+		if (bit(2) && negative) || (bit(1) && zero) || (bit(0) && !negative && !zero) {
+			pc = target
+		}
+	}
+
+	return int(int16(d)), memory
+}
+
+func TestRuntimeIf(t *testing.T) {
+	input := `
+		@R0
+		D=M
+	.if D>0
+		D=1
+	.elif D==0
+		D=0
+	.else
+		D=-1
+	.endif
+	`
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		input    int
+		expected int
+	}{
+		{5, 1},
+		{0, 0},
+		{-5, -1},
+	}
+
+	for _, test := range tests {
+		d, _ := run(t, result, map[int]int{0: test.input})
+		assert.Equal(t, test.expected, d, "R0=%d", test.input)
+	}
+}
+
+func TestRuntimeConditionsUseTheInverseJump(t *testing.T) {
+	tests := []struct {
+		operator string
+		// Whether the condition holds when D is -1, 0 and 1
+		holds [3]bool
+	}{
+		{"<", [3]bool{true, false, false}},
+		{"<=", [3]bool{true, true, false}},
+		{">", [3]bool{false, false, true}},
+		{">=", [3]bool{false, true, true}},
+		{"==", [3]bool{false, true, false}},
+		{"!=", [3]bool{true, false, true}},
+	}
+
+	for _, test := range tests {
+		result, err := New().Convert("@R0\nD=M\n.if D" + test.operator + "0\n@R1\nM=1\n.endif")
+		assert.NoError(t, err)
+
+		for index, value := range []int{-1, 0, 1} {
+			_, ram := run(t, result, map[int]int{0: value})
+			assert.Equal(t, test.holds[index], ram[1] == 1, "D%s0 when D is %d", test.operator, value)
+		}
+	}
+}
+
+func TestRuntimeWhile(t *testing.T) {
+	// Sums R0 + (R0-1) + ... + 1 into R1
+	input := `
+		@R0
+		D=M
+	.while D>0
+		@R1
+		M=D+M
+		@R0
+		MD=M-1
+	.endwhile
+	`
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
+
+	_, ram := run(t, result, map[int]int{0: 4})
+	assert.Equal(t, 10, ram[1])
+
+	_, ram = run(t, result, map[int]int{0: 0})
+	assert.Equal(t, 0, ram[1])
+}
+
+func TestRuntimeLoop(t *testing.T) {
+	input := `
+	.equ TIMES 3
+	.loop TIMES
+		.loop 2
+			@R1
+			M=M+1
+		.endloop
+	.endloop
+	.loop 0
+		@R2
+		M=1
+	.endloop
+	`
+	a := New()
+	a.Strict = true
+	result, err := a.Convert(input)
+	assert.NoError(t, err)
+	assert.Empty(t, a.Warnings())
+
+	_, ram := run(t, result, nil)
+	assert.Equal(t, 6, ram[1])
+	assert.Equal(t, 0, ram[2])
+}
+
+func TestRuntimeStatementsWithinMacros(t *testing.T) {
+	input := `
+	.macro ABS
+	.if D<0
+		D=-D
+	.endif
+	.endm
+		@R0
+		D=M
+		ABS
+		@R1
+		M=D
+		@R2
+		D=M
+		ABS
+		@R3
+		M=D
+	`
+	result, err := New().Convert(input)
+	assert.NoError(t, err)
+
+	_, ram := run(t, result, map[int]int{0: -7, 2: 8})
+	assert.Equal(t, 7, ram[1])
+	assert.Equal(t, 8, ram[3])
+}
@@ -0,0 +1,167 @@
+package assembler
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/token"
+)
+
+// Phase is the stage of the assembler that an error was encountered in
+type Phase int
+
+const (
+	LEX Phase = iota
+	PARSE
+	EXPAND
+	RESOLVE
+	ENCODE
+	ANALYZE
+)
+
+func (p Phase) String() string {
+	switch p {
+	case LEX:
+		return "lex"
+	case PARSE:
+		return "parse"
+	case EXPAND:
+		return "expand"
+	case RESOLVE:
+		return "resolve"
+	case ENCODE:
+		return "encode"
+	case ANALYZE:
+		return "analyze"
+	}
+
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// Severity distinguishes errors, which stop a program from being assembled, from warnings
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+)
+
+func (s Severity) String() string {
+	switch s {
+	case ERROR:
+		return "error"
+	case WARNING:
+		return "warning"
+	}
+
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Identifiers for each kind of error found after parsing, which are stable for use by tooling.
+// Parse errors use the identifiers from the parser package.
+const (
+	UnexpectedInstruction     = "unexpected-instruction"
+	InvalidInstruction        = "invalid-instruction"
+	DuplicateLabel            = "duplicate-label"
+	PredefinedLabel           = "predefined-label"
+	RAMExhausted              = "ram-exhausted"
+	ROMOverflow               = "rom-overflow"
+	LabelOutOfRange           = "label-out-of-range"
+	UndeclaredSymbol          = "undeclared-symbol"
+	DuplicateVariable         = "duplicate-variable"
+	PredefinedVariable        = "predefined-variable"
+	VariableAddressConflict   = "variable-address-conflict"
+	VariableAddressOutOfRange = "variable-address-out-of-range"
+	UnallocatedVariable       = "unallocated-variable"
+	ValueOutOfRange           = "value-out-of-range"
+	DuplicateConstant         = "duplicate-constant"
+	PredefinedConstant        = "predefined-constant"
+	InvalidConstant           = "invalid-constant"
+	IncludeNotFound           = "include-not-found"
+	IncludeCycle              = "include-cycle"
+	UnknownMacro              = "unknown-macro"
+	DuplicateMacro            = "duplicate-macro"
+	MacroArgumentCount        = "macro-argument-count"
+	MacroTooDeep              = "macro-too-deep"
+	TooManyExpansions         = "too-many-expansions"
+	UnscopedLocalLabel        = "unscoped-local-label"
+	UndefinedLocalLabel       = "undefined-local-label"
+	UndefinedAnonymousLabel   = "undefined-anonymous-label"
+	InvalidLoad               = "invalid-load"
+	InvalidCondition          = "invalid-condition"
+	ErrorDirective            = "error-directive"
+	InvalidRepeatCount        = "invalid-repeat-count"
+	InvalidAlias              = "invalid-alias"
+	DuplicateAlias            = "duplicate-alias"
+	ForeignModuleSymbol       = "foreign-module-symbol"
+	UndefinedModuleSymbol     = "undefined-module-symbol"
+)
+
+// A single problem found whilst assembling a program.
+// The instruction is not always available, for instance when the source could not be parsed.
+type AssemblyError struct {
+	Rule        string
+	Severity    Severity
+	Phase       Phase
+	Instruction ast.Instruction
+	Span        token.Span
+	Message     string
+	// Optional hints for fixing the error, such as a suggested spelling
+	Help  string
+	Notes []string
+	// Other locations which help to explain the error, such as a previous definition
+	Related []Related
+	// The include directives which led to the file containing the error, innermost first
+	IncludedFrom []token.Span
+}
+
+// A secondary location of an error
+type Related struct {
+	Span    token.Span
+	Message string
+}
+
+func (e *AssemblyError) Error() string {
+	var prefix string
+	if e.Span.Start.Line > 0 {
+		prefix = e.Span.Start.String() + ": "
+	}
+
+	message := e.Message
+	if e.Help != "" {
+		message = fmt.Sprintf("%s (%s)", message, e.Help)
+	}
+
+	if e.Instruction == nil {
+		return fmt.Sprintf("%s%s %s: %s", prefix, e.Phase, e.Severity, message)
+	}
+
+	return fmt.Sprintf("%s%s %s: %s: %s", prefix, e.Phase, e.Severity, e.Instruction, message)
+}
+
+func nodeSpan(node ast.Node) token.Span {
+	return token.Span{Start: node.Pos(), End: node.End()}
+}
+
+// All of the errors found whilst assembling a program
+type ErrorList []*AssemblyError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Describes a number of things, i.e. "1 variable" or "2 variables"
+func count(n int, singular string, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -0,0 +1,201 @@
+package assembler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+)
+
+// A file which is currently having its includes expanded
+type includedFile struct {
+	// The absolute path of the file, used to recognise the same file included by different paths
+	key  string
+	name string
+}
+
+type includer struct {
+	a *Assembler
+	// The files being expanded, from the entry file to the innermost included file
+	stack []includedFile
+	// Files are only included once, any later includes of the same file are ignored
+	included map[string]bool
+	// Conditionals are resolved as files are included, so that only the files within
+	// the chosen branches are read
+	conditions *conditionResolver
+	errs       ErrorList
+}
+
+func (a *Assembler) newIncluder(file string, conditions *conditionResolver) *includer {
+	i := &includer{a: a, included: map[string]bool{}, conditions: conditions}
+	entry := includedFile{key: absolute(file), name: file}
+	i.stack = append(i.stack, entry)
+	i.included[entry.key] = true
+
+	return i
+}
+
+// Replaces each .include directive with the instructions of the included file, which
+// may include further files. Each file is only included once. Conditionals outside
+// of macros are replaced with the body of their chosen branch. Includes within a macro
+// or repetition are left until it is expanded, so that a macro which is never called,
+// or a block which is repeated 0 times, includes nothing.
+func (a *Assembler) expandIncludes(program ast.Program, i *includer) (ast.Program, ErrorList) {
+	return ast.Program{Instructions: i.expand(program.Instructions, i.stack[0].name)}, i.errs
+}
+
+func (i *includer) expand(instructions []ast.Instruction, file string) []ast.Instruction {
+	var expanded []ast.Instruction
+	for _, instruction := range instructions {
+		switch instruction := instruction.(type) {
+		case *ast.IncludeDirective:
+			expanded = append(expanded, i.include(instruction, file)...)
+		case *ast.ConditionalDirective:
+			body, err := i.conditions.choose(instruction)
+			if err != nil {
+				i.errs = append(i.errs, err)
+				continue
+			}
+			expanded = append(expanded, i.expand(body, file)...)
+		case *ast.ErrorDirective:
+			i.errs = append(i.errs, errorDirectiveError(instruction))
+		case *ast.ConstantDirective:
+			i.conditions.define(instruction)
+			expanded = append(expanded, instruction)
+		default:
+			expanded = append(expanded, instruction)
+		}
+	}
+
+	return expanded
+}
+
+func (i *includer) include(directive *ast.IncludeDirective, from string) []ast.Instruction {
+	name, source, err := i.find(directive, from)
+	if err != nil {
+		i.errs = append(i.errs, err)
+		return nil
+	}
+
+	file := includedFile{key: absolute(name), name: name}
+	for index, including := range i.stack {
+		if including.key == file.key {
+			i.errs = append(i.errs, i.cycleError(directive, index))
+			return nil
+		}
+	}
+
+	if i.included[file.key] {
+		return nil
+	}
+	i.included[file.key] = true
+	i.a.sources[name] = source
+	i.a.includedFrom[name] = directive.Span
+
+	program, errs := i.a.parse(name, source)
+	i.errs = append(i.errs, errs...)
+
+	i.stack = append(i.stack, file)
+	expanded := i.expand(program.Instructions, name)
+	i.stack = i.stack[:len(i.stack)-1]
+
+	return expanded
+}
+
+// Finds an included file relative to the including file, and then within each include path
+func (i *includer) find(directive *ast.IncludeDirective, from string) (string, string, *AssemblyError) {
+	candidates := []string{directive.Path}
+	if !filepath.IsAbs(directive.Path) {
+		candidates = []string{filepath.Join(filepath.Dir(from), directive.Path)}
+		for _, dir := range i.a.IncludePaths {
+			candidates = append(candidates, filepath.Join(dir, directive.Path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		data, err := i.a.ReadFile(candidate)
+		if err == nil {
+			return candidate, string(data), nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", "", &AssemblyError{
+				Rule:        IncludeNotFound,
+				Phase:       EXPAND,
+				Instruction: directive,
+				Span:        nodeSpan(directive),
+				Message:     fmt.Sprintf("can not read included file %q: %s", candidate, err),
+			}
+		}
+	}
+
+	return "", "", &AssemblyError{
+		Rule:        IncludeNotFound,
+		Phase:       EXPAND,
+		Instruction: directive,
+		Span:        nodeSpan(directive),
+		Message:     fmt.Sprintf("included file %q not found", directive.Path),
+		Notes:       []string{"searched " + strings.Join(candidates, ", ")},
+		Help:        "add the directory containing the file to the include paths with -I",
+	}
+}
+
+// Explains each step of the cycle, starting from the first file within it
+func (i *includer) cycleError(directive *ast.IncludeDirective, start int) *AssemblyError {
+	var notes []string
+	cycle := i.stack[start:]
+	for index, file := range cycle {
+		next := cycle[0].name
+		if index+1 < len(cycle) {
+			next = cycle[index+1].name
+		}
+		notes = append(notes, fmt.Sprintf("%s includes %s", displayName(file.name), displayName(next)))
+	}
+
+	return &AssemblyError{
+		Rule:        IncludeCycle,
+		Phase:       EXPAND,
+		Instruction: directive,
+		Span:        nodeSpan(directive),
+		Message:     fmt.Sprintf("including %q forms a cycle", directive.Path),
+		Notes:       notes,
+	}
+}
+
+// Adds the chain of include directives which led to the file of each error
+func (a *Assembler) addIncludeChains(errs ErrorList) {
+	for _, err := range errs {
+		err.IncludedFrom = nil
+		file := err.Span.Start.File
+		for {
+			span, ok := a.includedFrom[file]
+			if !ok {
+				break
+			}
+			err.IncludedFrom = append(err.IncludedFrom, span)
+			file = span.Start.File
+		}
+	}
+}
+
+func absolute(file string) string {
+	if file == "" {
+		return ""
+	}
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Clean(file)
+	}
+	return path
+}
+
+func displayName(file string) string {
+	if file == "" {
+		return "<input>"
+	}
+
+	return file
+}
@@ -0,0 +1,147 @@
+package assembler
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Reads included files from memory rather than from disk
+func withFiles(a *Assembler, files map[string]string) *Assembler {
+	a.ReadFile = func(name string) ([]byte, error) {
+		source, ok := files[name]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return []byte(source), nil
+	}
+	return a
+}
+
+func TestInclude(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"src/lib/screen.asm": ".equ ROW 32\n",
+	})
+	result, err := a.ConvertFile("src/main.asm", ".include \"lib/screen.asm\"\n@ROW\nD=A\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000100000
+		1110110000010000
+	`), result)
+	assert.Equal(t, ".equ ROW 32\n", a.Sources()["src/lib/screen.asm"])
+}
+
+func TestIncludeSearchPaths(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"vendor/math.asm": "@R0\n",
+		"lib/math.asm":    "@R1\n",
+	})
+	a.IncludePaths = []string{"vendor", "lib"}
+	result, err := a.ConvertFile("main.asm", ".include \"math.asm\"\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "0000000000000000", result)
+}
+
+func TestIncludeOnce(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"a.asm":      ".include \"common.asm\"\n@1\n",
+		"common.asm": "@R0\n",
+	})
+	result, err := a.ConvertFile("main.asm", ".include \"common.asm\"\n.include \"a.asm\"\n.include \"./common.asm\"\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000000
+		0000000000000001
+	`), result)
+}
+
+func TestIncludeNotFound(t *testing.T) {
+	a := withFiles(New(), map[string]string{})
+	a.IncludePaths = []string{"lib"}
+	_, err := a.ConvertFile("src/main.asm", "@R0\n.include \"missing.asm\"\n")
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, IncludeNotFound, errs[0].Rule)
+	assert.Equal(t, EXPAND, errs[0].Phase)
+	assert.Equal(t, `included file "missing.asm" not found`, errs[0].Message)
+	assert.Equal(t, []string{"searched src/missing.asm, lib/missing.asm"}, errs[0].Notes)
+	assert.Equal(t, 2, errs[0].Span.Start.Line)
+}
+
+func TestIncludeCycle(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"a.asm": ".include \"b.asm\"\n",
+		"b.asm": "@R0\n.include \"a.asm\"\n",
+	})
+	_, err := a.ConvertFile("a.asm", ".include \"b.asm\"\n")
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, IncludeCycle, errs[0].Rule)
+	assert.Equal(t, `including "a.asm" forms a cycle`, errs[0].Message)
+	assert.Equal(t, []string{"a.asm includes b.asm", "b.asm includes a.asm"}, errs[0].Notes)
+	assert.Equal(t, "b.asm", errs[0].Span.Start.File)
+	assert.Len(t, errs[0].IncludedFrom, 1)
+	assert.Equal(t, "a.asm", errs[0].IncludedFrom[0].Start.File)
+}
+
+func TestErrorsInIncludedFilesHaveIncludeChain(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"a.asm": "\n.include \"b.asm\"\n",
+		"b.asm": "D=D+D\n",
+	})
+	_, err := a.ConvertFile("main.asm", ".include \"a.asm\"\n")
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "b.asm", errs[0].Span.Start.File)
+	assert.Len(t, errs[0].IncludedFrom, 2)
+	assert.Equal(t, "a.asm:2:1", errs[0].IncludedFrom[0].Start.String())
+	assert.Equal(t, "main.asm:1:1", errs[0].IncludedFrom[1].Start.String())
+}
+
+func TestWarningsInIncludedFilesAreOrderedByProgram(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"lib.asm": strings.Repeat("\n", 20) + "(UNUSED_IN_LIBRARY)\n@R0\n",
+	})
+	_, err := a.ConvertFile("main.asm", ".include \"lib.asm\"\n(UNUSED)\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`lib.asm:21:1: analyze warning: (UNUSED_IN_LIBRARY): label "UNUSED_IN_LIBRARY" is never used`,
+		`main.asm:2:1: analyze warning: (UNUSED): label "UNUSED" is never used`,
+	}, messages(a.Warnings()))
+	assert.Len(t, a.Warnings()[0].IncludedFrom, 1)
+}
+
+func TestIncludesWithinMacrosAreReadWhenCalled(t *testing.T) {
+	files := map[string]string{"lib.asm": "(LIBFN)\n@LIBFN\n0;JMP\n"}
+	expected := removeWhitespace(`
+		0000000000000000
+		1110101010000111
+		0000000000000000
+	`)
+
+	// A macro which is never called does not stop the file being included later
+	result, err := withFiles(New(), files).ConvertFile("main.asm", ".macro SETUP\n.include \"lib.asm\"\n.endm\n.include \"lib.asm\"\n@LIBFN\n")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	result, err = withFiles(New(), files).ConvertFile("main.asm", ".macro SETUP\n.include \"lib.asm\"\n.endm\nSETUP\n@LIBFN\n")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+}
+
+func TestIncludesWithinSkippedBlocksAreNotRead(t *testing.T) {
+	input := ".rept 0\n.include \"missing.asm\"\n.endr\n.macro SETUP\n.if 0\n.include \"missing.asm\"\n.endif\n.endm\nSETUP\n@R0\n"
+	result, err := withFiles(New(), map[string]string{}).ConvertFile("main.asm", input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "0000000000000000", result)
+}
@@ -0,0 +1,193 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+)
+
+// Gives local and anonymous labels, and each reference to them, a name which is unique
+// within the program.
+//
+// Local labels such as (.loop) belong to the closest global label before them, so that
+// (.loop) after (MAIN) becomes MAIN.loop. They are referenced as @.loop from within the
+// same global label, or as @MAIN.loop from anywhere.
+//
+// Anonymous labels (:) are numbered in order, and are referenced relative to the
+// instruction which uses them. @:+ is the next anonymous label, @:++ the one after, and
+// @:- the previous anonymous label. Those within a macro expansion are marked with it,
+// and only match each other.
+func scopeLabels(program ast.Program) ErrorList {
+	var errs ErrorList
+
+	// The global label which each instruction belongs to
+	scopes := make([]string, len(program.Instructions))
+	// Local labels by their full name, and the position of each anonymous label by its expansion
+	locals := map[string]bool{}
+	anonymous := map[string][]int{}
+
+	scope := ""
+	for index, instruction := range program.Instructions {
+		if label, ok := instruction.(*ast.LInstruction); ok {
+			switch {
+			case isAnonymousLabel(label.Value):
+				_, expansion := anonymousExpansion(label.Value)
+				anonymous[expansion] = append(anonymous[expansion], index)
+				label.Value = fmt.Sprintf(":%d%s", len(anonymous[expansion]), expansion)
+			case isLocalLabel(label.Value):
+				if scope == "" {
+					errs = append(errs, &AssemblyError{
+						Rule:        UnscopedLocalLabel,
+						Phase:       RESOLVE,
+						Instruction: label,
+						Span:        nodeSpan(label),
+						Message:     fmt.Sprintf("local label %q is not within a global label", label.Value),
+						Help:        "local labels must follow a global label, such as (MAIN)",
+					})
+					break
+				}
+				label.Value = scope + label.Value
+				locals[label.Value] = true
+			case !isGeneratedSymbol(label.Value):
+				// Labels within a macro expansion do not start a new scope
+				scope = label.Value
+			}
+		}
+		scopes[index] = scope
+	}
+
+	for index, instruction := range program.Instructions {
+		replace := func(variable *ast.Variable) ast.AInstructionValue {
+			name, err := resolveLabel(variable, instruction, scopes[index], locals, anonymous, index)
+			if err != nil {
+				errs = append(errs, err)
+				return variable
+			}
+			return &ast.Variable{Name: name, Span: variable.Span}
+		}
+
+		switch instruction := instruction.(type) {
+		case *ast.AInstruction:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		case *ast.ConstantDirective:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		case *ast.LoadInstruction:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		}
+	}
+
+	return errs
+}
+
+// Finds the full name of the label that a symbol refers to. Symbols which are not local
+// or anonymous labels are returned unchanged.
+func resolveLabel(variable *ast.Variable, instruction ast.Instruction, scope string, locals map[string]bool, anonymous map[string][]int, index int) (string, *AssemblyError) {
+	name := variable.Name
+	if isAnonymousReference(name) {
+		return resolveAnonymousLabel(variable, instruction, anonymous, index)
+	}
+	if !isLocalLabel(name) {
+		return name, nil
+	}
+
+	err := &AssemblyError{
+		Phase:       RESOLVE,
+		Instruction: instruction,
+		Span:        nodeSpan(variable),
+	}
+	if scope == "" {
+		err.Rule = UnscopedLocalLabel
+		err.Message = fmt.Sprintf("local label %q is referenced outside of any global label", name)
+	} else if locals[scope+name] {
+		return scope + name, nil
+	} else {
+		err.Rule = UndefinedLocalLabel
+		err.Message = fmt.Sprintf("local label %q is not defined within %q", name, scope)
+	}
+
+	// Local labels of the same name within other global labels can be referenced by their full name
+	var others []string
+	for local := range locals {
+		if strings.HasSuffix(local, name) {
+			others = append(others, local)
+		}
+	}
+	sort.Strings(others)
+	for _, other := range others {
+		err.Notes = append(err.Notes, fmt.Sprintf("%q is defined within %q, and can be referenced as %s", name, strings.TrimSuffix(other, name), other))
+	}
+
+	return "", err
+}
+
+func resolveAnonymousLabel(variable *ast.Variable, instruction ast.Instruction, labels map[string][]int, index int) (string, *AssemblyError) {
+	reference, expansion := anonymousExpansion(variable.Name)
+	anonymous := labels[expansion]
+	distance := len(reference) - 1
+	forward := reference[1] == '+'
+
+	// The anonymous labels are in program order, and never at the position of the reference
+	next := sort.SearchInts(anonymous, index)
+	target, available, direction := next+distance-1, len(anonymous)-next, "follow"
+	if !forward {
+		target, available, direction = next-distance, next, "precede"
+	}
+
+	if target >= 0 && target < len(anonymous) {
+		return fmt.Sprintf(":%d%s", target+1, expansion), nil
+	}
+
+	if available == 1 {
+		direction += "s"
+	}
+	return "", &AssemblyError{
+		Rule:        UndefinedAnonymousLabel,
+		Phase:       RESOLVE,
+		Instruction: instruction,
+		Span:        nodeSpan(variable),
+		Message:     fmt.Sprintf("anonymous label reference %q has no matching label", reference),
+		Notes:       []string{fmt.Sprintf("%s %s this instruction", count(available, "anonymous label", "anonymous labels"), direction)},
+		Help:        "anonymous labels are defined with (:)",
+	}
+}
+
+func isLocalLabel(name string) bool {
+	return len(name) > 1 && name[0] == '.'
+}
+
+// A reference such as :+ or :--
+func isAnonymousReference(name string) bool {
+	name, _ = anonymousExpansion(name)
+	return len(name) > 1 && name[0] == ':' && strings.Trim(name[1:], name[1:2]) == ""
+}
+
+// Splits an anonymous label or reference from the expansion it was copied into, such as :-#3
+func anonymousExpansion(name string) (string, string) {
+	if index := strings.Index(name, "#"); index >= 0 {
+		return name[:index], name[index:]
+	}
+
+	return name, ""
+}
+
+func isAnonymousLabel(name string) bool {
+	return strings.HasPrefix(name, ":")
+}
+
+// Symbols which are named by the assembler, rather than written in the source, such as
+// labels within a macro expansion, anonymous labels, and the counters of runtime loops.
+// They can not be referenced by name.
+func isGeneratedSymbol(name string) bool {
+	return isAnonymousLabel(name) || strings.Contains(name, "#")
+}
+
+// Describes a label within a diagnostic, as anonymous labels have no name of their own
+func describeLabel(name string) string {
+	if isAnonymousLabel(name) {
+		return "anonymous label"
+	}
+
+	return fmt.Sprintf("label %q", name)
+}
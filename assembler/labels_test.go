@@ -0,0 +1,153 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalLabels(t *testing.T) {
+	input := `
+	(MAIN)
+		@.loop
+		0;JMP
+	(.loop)
+		@.loop
+		0;JMP
+	(OTHER)
+	(.loop)
+		@MAIN.loop
+		0;JMP
+	`
+	a := New()
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000010
+		1110101010000111
+		0000000000000010
+		1110101010000111
+		0000000000000010
+		1110101010000111
+	`), result)
+	assert.Equal(t, []string{
+		`2:2: analyze warning: (MAIN): label "MAIN" is never used`,
+		`8:2: analyze warning: (OTHER): label "OTHER" is never used`,
+		`9:2: analyze warning: (OTHER.loop): label "OTHER.loop" is never used`,
+	}, messages(a.Warnings()))
+}
+
+func TestAnonymousLabels(t *testing.T) {
+	input := `
+	(:)
+		@:+
+		D;JEQ
+		@:-
+		0;JMP
+	(:)
+		@:--
+		0;JMP
+	(:)
+	`
+	a := New()
+	result, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000100
+		1110001100000010
+		0000000000000000
+		1110101010000111
+		0000000000000000
+		1110101010000111
+	`), result)
+	assert.Equal(t, []string{
+		`10:2: analyze warning: (:3): anonymous label is never used`,
+	}, messages(a.Warnings()))
+}
+
+func TestAnonymousLabelsWithinMacros(t *testing.T) {
+	input := `
+	.macro WAIT
+	(:)
+		@:-
+		0;JMP
+	.endm
+	(:)
+		@R0
+		WAIT
+		@:-
+		0;JMP
+	`
+	result, err := New().Convert(input)
+
+	// The caller's reference skips the label within the expansion
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000000
+		0000000000000001
+		1110101010000111
+		0000000000000000
+		1110101010000111
+	`), result)
+
+	input = `
+	.macro SKIP
+		@:+
+		0;JMP
+	.endm
+		SKIP
+	(:)
+	`
+	_, err = New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, UndefinedAnonymousLabel, errs[0].Rule)
+	assert.Equal(t, `anonymous label reference ":+" has no matching label`, errs[0].Message)
+}
+
+func TestLabelScopingErrors(t *testing.T) {
+	input := `
+	(.early)
+	(MAIN)
+		@.done
+	(OTHER)
+	(.done)
+		@:+
+		@:--
+	(:)
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, UnscopedLocalLabel, errs[0].Rule)
+	assert.Equal(t, `local label ".early" is not within a global label`, errs[0].Message)
+	assert.Equal(t, UndefinedLocalLabel, errs[1].Rule)
+	assert.Equal(t, `local label ".done" is not defined within "MAIN"`, errs[1].Message)
+	assert.Equal(t, []string{`".done" is defined within "OTHER", and can be referenced as OTHER.done`}, errs[1].Notes)
+	assert.Equal(t, 4, errs[1].Span.Start.Column)
+	assert.Equal(t, UndefinedAnonymousLabel, errs[2].Rule)
+	assert.Equal(t, `anonymous label reference ":--" has no matching label`, errs[2].Message)
+	assert.Equal(t, []string{"0 anonymous labels precede this instruction"}, errs[2].Notes)
+}
+
+func TestMacroLabelsDoNotStartScope(t *testing.T) {
+	input := `
+	.macro WAIT
+	(LOOP)
+		@LOOP
+		0;JMP
+	.endm
+	(MAIN)
+		WAIT
+	(.end)
+		@.end
+		0;JMP
+	`
+	_, err := New().Convert(input)
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,55 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/alanfoster/assembler/ast"
+)
+
+// A line of the listing, which shows the binary output for an instruction of the source
+type ListingEntry struct {
+	// The ROM address of the first instruction output, or of the next instruction for labels
+	Address int
+	// The instruction from the source, after any macros have been expanded
+	Source ast.Instruction
+	// The real instructions output to ROM, which differ from the source for pseudo-instructions
+	Instructions []ast.Instruction
+	Binary       []string
+}
+
+// The listing from the most recent successful conversion
+func (a *Assembler) Listing() []ListingEntry {
+	return a.listing
+}
+
+// Writes a listing of each ROM address alongside its binary and instruction, for example:
+//
+//	0  0000000000000101  @5                 // D=#-5
+//	1  1110110010010000  D=-A
+//	                     (LOOP)
+//
+// Pseudo-instructions are followed by the source they were expanded from, and the branches
+// of conditionals which were not assembled are shown by the lines they skipped.
+func WriteListing(w io.Writer, listing []ListingEntry) error {
+	for _, entry := range listing {
+		if len(entry.Instructions) == 0 {
+			if _, err := fmt.Fprintf(w, "%5s  %16s  %v\n", "", "", entry.Source); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for index, instruction := range entry.Instructions {
+			line := fmt.Sprintf("%5d  %s  %v", entry.Address+index, entry.Binary[index], instruction)
+			if index == 0 && instruction != entry.Source {
+				line = fmt.Sprintf("%-44s// %v", line, entry.Source)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/generator"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// Computations which load a value without an A-instruction, by the 16-bit value they load
+var singleInstructionLoads = map[int]string{
+	0:      "0",
+	1:      "1",
+	0xFFFF: "-1",
+}
+
+// The number of instructions which each load instruction expands to. Values which can be
+// evaluated before labels are placed use the shortest sequence, whereas values which depend
+// on a label use two instructions, which is enough to load any value.
+func (a *Assembler) loadSizes(program ast.Program) map[*ast.LoadInstruction]int {
+	sizes := map[*ast.LoadInstruction]int{}
+	var st symboltable.SymbolTable
+
+	for _, instruction := range program.Instructions {
+		load, ok := instruction.(*ast.LoadInstruction)
+		if !ok {
+			continue
+		}
+
+		// Constants which depend on labels fail to evaluate, and so are left undefined
+		if st == nil {
+			st = symboltable.New()
+			a.defineExternalConstants(st)
+			a.defineConstants(program, st)
+		}
+
+		sizes[load] = 2
+		if value, err := generator.Evaluate(load.Value, st); err == nil {
+			if expansion, err := expandLoad(load, value, 0); err == nil {
+				sizes[load] = len(expansion)
+			}
+		}
+	}
+
+	return sizes
+}
+
+// The real instructions which load the value into the destination. Shorter sequences are
+// padded with instructions which do nothing, so that they have the given size.
+func expandLoad(load *ast.LoadInstruction, value int, size int) ([]ast.Instruction, error) {
+	if value < generator.MinLoadValue || value > generator.MaxLoadValue {
+		return nil, fmt.Errorf("value %d is %w, loaded values can be %d to %d", value, generator.ErrOutOfRange, generator.MinLoadValue, generator.MaxLoadValue)
+	}
+
+	bits := value & 0xFFFF
+	dest := load.Destination.Value
+	compute := func(comp string) ast.Instruction {
+		return &ast.CInstruction{Destination: load.Destination, Command: ast.Command{Value: comp, Span: load.Span}, Span: load.Span}
+	}
+	address := func(value int) ast.Instruction {
+		return &ast.AInstruction{Value: &ast.Number{Value: value, Span: nodeSpan(load.Value)}, Span: load.Span}
+	}
+
+	var expansion []ast.Instruction
+	if comp, ok := singleInstructionLoads[bits]; ok {
+		expansion = []ast.Instruction{compute(comp)}
+	} else if strings.Contains(dest, "M") {
+		return nil, fmt.Errorf("%s can only be loaded with 0, 1 or -1, as loading any other value changes A", dest)
+	} else if bits <= generator.MaxValue && dest == "A" {
+		expansion = []ast.Instruction{address(bits)}
+	} else if bits <= generator.MaxValue {
+		expansion = []ast.Instruction{address(bits), compute("A")}
+	} else if negated := 0x10000 - bits; negated <= generator.MaxValue {
+		expansion = []ast.Instruction{address(negated), compute("-A")}
+	} else {
+		expansion = []ast.Instruction{address(^bits & 0xFFFF), compute("!A")}
+	}
+
+	for len(expansion) < size {
+		expansion = append(expansion, &ast.CInstruction{Command: ast.Command{Value: "0", Span: load.Span}, Span: load.Span})
+	}
+
+	return expansion, nil
+}
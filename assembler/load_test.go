@@ -0,0 +1,95 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadInstructions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"D=#0", []string{"D=0"}},
+		{"D=#1", []string{"D=1"}},
+		{"D=#-1", []string{"D=-1"}},
+		{"D=#0xFFFF", []string{"D=-1"}},
+		{"M=#-1", []string{"M=-1"}},
+		{"A=#100", []string{"@100"}},
+		{"D=#100", []string{"@100", "D=A"}},
+		{"D=#-5", []string{"@5", "D=-A"}},
+		{"AD=#-32767", []string{"@32767", "AD=-A"}},
+		{"D=#-32768", []string{"@32767", "D=!A"}},
+		{"D=#0x8000", []string{"@32767", "D=!A"}},
+		{"D=#SCREEN+1", []string{"@16385", "D=A"}},
+	}
+
+	for _, test := range tests {
+		a := New()
+		_, err := a.Convert(test.input)
+		assert.NoError(t, err, test.input)
+
+		var actual []string
+		for _, instruction := range a.Listing()[0].Instructions {
+			actual = append(actual, instruction.String())
+		}
+		assert.Equal(t, test.expected, actual, test.input)
+	}
+}
+
+func TestLoadInstructionsDependingOnLabels(t *testing.T) {
+	input := `
+	(START)
+		D=#START-1
+		D=#END
+	(END)
+		@START
+	`
+	a := New()
+	result, err := a.Convert(input)
+
+	// Values which depend on labels always use two instructions, as they are not known in advance
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		1110111010010000
+		1110101010000000
+		0000000000000100
+		1110110000010000
+		0000000000000000
+	`), result)
+}
+
+func TestLoadInstructionErrors(t *testing.T) {
+	input := `
+		M=#5
+		D=#-40000+1
+		D=#x
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, InvalidLoad, errs[0].Rule)
+	assert.Equal(t, "M can only be loaded with 0, 1 or -1, as loading any other value changes A", errs[0].Message)
+	assert.Equal(t, ValueOutOfRange, errs[1].Rule)
+	assert.Equal(t, "value -39999 is out of range, loaded values can be -32768 to 65535", errs[1].Message)
+	assert.Equal(t, UnallocatedVariable, errs[2].Rule)
+}
+
+func TestListing(t *testing.T) {
+	input := "(LOOP)\nD=#-5\n@LOOP\n0;JMP"
+	a := New()
+	_, err := a.Convert(input)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteListing(&out, a.Listing()))
+	assert.Equal(t, ""+
+		"                         (LOOP)\n"+
+		"    0  0000000000000101  @5                 // D=#-5\n"+
+		"    1  1110110011010000  D=-A\n"+
+		"    2  0000000000000000  @LOOP\n"+
+		"    3  1110101010000111  0;JMP\n", out.String())
+}
@@ -0,0 +1,456 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// The number of macro calls which can be nested within each other, which stops
+// a macro which calls itself from expanding forever
+const MaxMacroDepth = 64
+
+// The most macro calls and repetitions which are expanded in total, which stops a macro
+// that calls itself more than once from expanding exponentially
+const MaxExpansions = 1 << 20
+
+type macroExpander struct {
+	a      *Assembler
+	macros map[string]*ast.MacroDefinition
+	// The calls currently being expanded, outermost first
+	calls []*ast.MacroCall
+	// The number of expansions so far, which gives each expansion its own labels
+	expansions int
+	// The number of macro calls and repetitions being expanded within each other
+	depth int
+	// The number of instructions which expansions have produced so far
+	produced int
+	// Set once macros are nested too deeply, so that the rest of the outermost expansion is abandoned
+	abandoned bool
+	// Set once MaxExpansions is reached, after which nothing more is expanded
+	exhausted bool
+	// Reads the files included by each expansion, which is shared with the top level so that each file is only included once
+	includes   *includer
+	conditions *conditionResolver
+	errs       ErrorList
+}
+
+// Replaces each macro call with the body of its macro. Labels defined within a macro
+// are renamed for each expansion, so that a macro can be used more than once.
+// Conditionals within the body are resolved after its arguments are substituted.
+func (a *Assembler) expandMacros(program ast.Program, includes *includer) (ast.Program, ErrorList) {
+	m := &macroExpander{
+		a:          a,
+		macros:     map[string]*ast.MacroDefinition{},
+		includes:   includes,
+		conditions: includes.conditions,
+	}
+	m.define(program.Instructions)
+
+	return ast.Program{Instructions: m.expand(program.Instructions)}, m.errs
+}
+
+// Records each macro definition, so that it can be called from anywhere within the program
+func (m *macroExpander) define(instructions []ast.Instruction) {
+	for _, instruction := range instructions {
+		definition, ok := instruction.(*ast.MacroDefinition)
+		if !ok {
+			continue
+		}
+
+		if previous, ok := m.macros[definition.Name]; ok {
+			m.errs = append(m.errs, &AssemblyError{
+				Rule:        DuplicateMacro,
+				Phase:       EXPAND,
+				Instruction: definition,
+				Span:        nodeSpan(definition),
+				Message:     fmt.Sprintf("macro %q is already defined", definition.Name),
+				Related: []Related{
+					{Span: nodeSpan(previous), Message: fmt.Sprintf("macro %q was first defined here", definition.Name)},
+				},
+			})
+			continue
+		}
+		m.macros[definition.Name] = definition
+	}
+}
+
+func (m *macroExpander) expand(instructions []ast.Instruction) []ast.Instruction {
+	var expanded []ast.Instruction
+	for _, instruction := range instructions {
+		if m.depth > 0 && (m.abandoned || m.exhausted) {
+			break
+		}
+
+		switch instruction := instruction.(type) {
+		case *ast.MacroDefinition:
+			// Definitions do not generate any instructions until they are called
+		case *ast.MacroCall:
+			expanded = append(expanded, m.call(instruction)...)
+		case *ast.IncludeDirective:
+			// Files included by a macro are found relative to the file defining the macro
+			reported := len(m.includes.errs)
+			included := m.includes.include(instruction, instruction.Span.Start.File)
+			m.errs = append(m.errs, m.includes.errs[reported:]...)
+			m.define(included)
+			expanded = append(expanded, m.expand(included)...)
+		case *ast.ConditionalDirective:
+			body, err := m.conditions.choose(instruction)
+			if err != nil {
+				m.errs = append(m.errs, err)
+				continue
+			}
+			expanded = append(expanded, m.expand(body)...)
+		case *ast.ErrorDirective:
+			m.errs = append(m.errs, errorDirectiveError(instruction))
+		case *ast.RepeatDirective:
+			expanded = append(expanded, m.repeat(instruction)...)
+		case *ast.IterateDirective:
+			expanded = append(expanded, m.iterate(instruction)...)
+		case *ast.ConstantDirective:
+			m.conditions.define(instruction)
+			expanded = append(expanded, instruction)
+		case *ast.AInstruction, *ast.CInstruction, *ast.LoadInstruction:
+			if m.depth > 0 {
+				m.produce(instruction)
+			}
+			expanded = append(expanded, instruction)
+		default:
+			expanded = append(expanded, instruction)
+		}
+	}
+
+	return expanded
+}
+
+func (m *macroExpander) call(call *ast.MacroCall) []ast.Instruction {
+	definition, ok := m.macros[call.Name]
+	if !ok {
+		m.errs = append(m.errs, m.unknownMacroError(call))
+		return nil
+	}
+
+	if len(call.Args) != len(definition.Params) {
+		m.errs = append(m.errs, &AssemblyError{
+			Rule:        MacroArgumentCount,
+			Phase:       EXPAND,
+			Instruction: call,
+			Span:        nodeSpan(call),
+			Message: fmt.Sprintf("macro %q expects %s, but was given %d", call.Name,
+				count(len(definition.Params), "argument", "arguments"), len(call.Args)),
+			Related: []Related{
+				{Span: nodeSpan(definition), Message: fmt.Sprintf("macro %q is defined here", call.Name)},
+			},
+		})
+		return nil
+	}
+
+	if len(m.calls) == MaxMacroDepth {
+		m.errs = append(m.errs, m.tooDeepError(call))
+		m.abandoned = true
+		return nil
+	}
+	if !m.canExpand(call) {
+		return nil
+	}
+
+	args := map[string]ast.AInstructionValue{}
+	for index, param := range definition.Params {
+		args[param] = call.Args[index]
+	}
+	from := append([]*ast.MacroCall{call}, m.a.expandedFrom[call]...)
+	body := m.substitute(definition.Body, definition.Name, args, from)
+
+	m.calls = append(m.calls, call)
+	expanded := m.nested(body)
+	m.calls = m.calls[:len(m.calls)-1]
+
+	return expanded
+}
+
+// Expands the body of a macro call or repetition. Once the outermost expansion is
+// complete, any expansion which was abandoned has finished unwinding.
+func (m *macroExpander) nested(body []ast.Instruction) []ast.Instruction {
+	m.depth++
+	expanded := m.expand(body)
+	m.depth--
+
+	if m.depth == 0 {
+		m.abandoned = false
+	}
+
+	return expanded
+}
+
+// Counts an instruction produced by an expansion. Expansion stops once more instructions
+// are produced than ROM can hold, rather than building an ever larger program.
+func (m *macroExpander) produce(instruction ast.Instruction) {
+	m.produced++
+	if m.produced <= symboltable.ROMSize || m.exhausted {
+		return
+	}
+
+	m.exhausted = true
+	m.errs = append(m.errs, &AssemblyError{
+		Rule:        ROMOverflow,
+		Phase:       EXPAND,
+		Instruction: instruction,
+		Span:        nodeSpan(instruction),
+		Message:     "macros and repetitions produce more instructions than ROM can hold",
+		Notes:       []string{fmt.Sprintf("ROM holds %d instructions", symboltable.ROMSize)},
+	})
+}
+
+// Reports whether another macro call or repetition can be expanded, reporting an error
+// the first time that MaxExpansions is reached
+func (m *macroExpander) canExpand(instruction ast.Instruction) bool {
+	if m.abandoned || m.exhausted {
+		return false
+	}
+
+	if m.expansions == MaxExpansions {
+		m.exhausted = true
+		m.errs = append(m.errs, &AssemblyError{
+			Rule:        TooManyExpansions,
+			Phase:       EXPAND,
+			Instruction: instruction,
+			Span:        nodeSpan(instruction),
+			Message:     "macros and repetitions are expanded too many times",
+			Notes:       []string{fmt.Sprintf("at most %d macro calls and repetitions can be expanded", MaxExpansions)},
+		})
+		return false
+	}
+
+	return true
+}
+
+// Copies the body of a macro or repetition, replacing each parameter with its argument
+// and giving each label and alias defined within the body a name which is unique to this
+// expansion.
+// Each copy records the macro calls it was expanded from.
+func (m *macroExpander) substitute(instructions []ast.Instruction, name string, args map[string]ast.AInstructionValue, from []*ast.MacroCall) []ast.Instruction {
+	m.expansions++
+	labels := map[string]string{}
+	var collect func(instructions []ast.Instruction)
+	collect = func(instructions []ast.Instruction) {
+		for _, instruction := range instructions {
+			switch instruction := instruction.(type) {
+			case *ast.LInstruction:
+				// Anonymous labels are marked with the expansion, so that they are only found by its references
+				if isAnonymousLabel(instruction.Value) {
+					labels[instruction.Value] = anonymousIn(instruction.Value, m.expansions)
+				} else {
+					labels[instruction.Value] = fmt.Sprintf("%s#%d.%s", name, m.expansions, instruction.Value)
+				}
+			case *ast.ConditionalDirective:
+				for _, branch := range instruction.Branches {
+					collect(branch.Body)
+				}
+			case *ast.AliasDirective:
+				labels[instruction.Name] = fmt.Sprintf("%s#%d.%s", name, m.expansions, instruction.Name)
+			case *ast.RepeatDirective:
+				collect(instruction.Body)
+			case *ast.IterateDirective:
+				collect(instruction.Body)
+			}
+		}
+	}
+	collect(instructions)
+
+	replace := func(variable *ast.Variable) ast.AInstructionValue {
+		if arg, ok := args[variable.Name]; ok {
+			// Expressions are grouped so that they are evaluated before any surrounding operators
+			if _, isBinary := arg.(*ast.BinaryExpression); isBinary {
+				return &ast.ParenExpression{Expression: arg, Span: nodeSpan(arg)}
+			}
+			return arg
+		}
+		if name, ok := labels[variable.Name]; ok {
+			return &ast.Variable{Name: name, Span: variable.Span}
+		}
+		if isAnonymousReference(variable.Name) {
+			return &ast.Variable{Name: anonymousIn(variable.Name, m.expansions), Span: variable.Span}
+		}
+		return variable
+	}
+
+	return m.copy(instructions, from, labels, replace)
+}
+
+// Marks an anonymous label or reference with the expansion it is copied into, replacing the
+// mark of any enclosing expansion which it was first copied into
+func anonymousIn(name string, expansion int) string {
+	name, _ = anonymousExpansion(name)
+	return fmt.Sprintf("%s#%d", name, expansion)
+}
+
+func (m *macroExpander) copy(instructions []ast.Instruction, from []*ast.MacroCall, labels map[string]string, replace func(*ast.Variable) ast.AInstructionValue) []ast.Instruction {
+	var body []ast.Instruction
+	for _, instruction := range instructions {
+		var copied ast.Instruction
+		switch instruction := instruction.(type) {
+		case *ast.AInstruction:
+			copied = &ast.AInstruction{Value: ast.ReplaceVariables(instruction.Value, replace), Span: instruction.Span}
+		case *ast.CInstruction:
+			c := *instruction
+			copied = &c
+		case *ast.LoadInstruction:
+			l := *instruction
+			l.Value = ast.ReplaceVariables(instruction.Value, replace)
+			copied = &l
+		case *ast.LInstruction:
+			label := *instruction
+			if name, ok := labels[instruction.Value]; ok {
+				label.Value = name
+			}
+			m.a.sourceLabels[&label] = m.a.sourceLabel(instruction)
+			copied = &label
+		case *ast.VarDirective:
+			v := *instruction
+			copied = &v
+		case *ast.ConstantDirective:
+			c := *instruction
+			c.Value = ast.ReplaceVariables(instruction.Value, replace)
+			copied = &c
+		case *ast.MacroCall:
+			nested := &ast.MacroCall{Name: instruction.Name, Span: instruction.Span}
+			for _, arg := range instruction.Args {
+				nested.Args = append(nested.Args, ast.ReplaceVariables(arg, replace))
+			}
+			copied = nested
+		case *ast.ConditionalDirective:
+			conditional := &ast.ConditionalDirective{Span: instruction.Span}
+			for _, branch := range instruction.Branches {
+				b := *branch
+				if branch.Condition != nil {
+					b.Condition = ast.ReplaceVariables(branch.Condition, replace)
+				}
+				// .ifdef and .ifndef only accept a name, so other arguments are not substituted
+				if _, isName := b.Condition.(*ast.Variable); !isName && branch.Directive != ".if" && branch.Directive != ".elif" {
+					b.Condition = branch.Condition
+				}
+				b.Body = m.copy(branch.Body, from, labels, replace)
+				conditional.Branches = append(conditional.Branches, &b)
+			}
+			copied = conditional
+		case *ast.ErrorDirective:
+			e := *instruction
+			copied = &e
+		case *ast.IncludeDirective:
+			include := *instruction
+			copied = &include
+		case *ast.AliasDirective:
+			alias := *instruction
+			alias.Name = labels[instruction.Name]
+			alias.Target = ast.ReplaceVariables(instruction.Target, replace)
+			copied = &alias
+		case *ast.RepeatDirective:
+			r := *instruction
+			r.Count = ast.ReplaceVariables(instruction.Count, replace)
+			r.Body = m.copy(instruction.Body, from, labels, replace)
+			copied = &r
+		case *ast.IterateDirective:
+			i := *instruction
+			i.Values = nil
+			for _, value := range instruction.Values {
+				i.Values = append(i.Values, ast.ReplaceVariables(value, replace))
+			}
+			i.Body = m.copy(instruction.Body, from, labels, replace)
+			copied = &i
+		default:
+			copied = instruction
+		}
+
+		// Each copy is distinct, so that diagnostics can find the calls which it came from
+		if len(from) > 0 {
+			m.a.expandedFrom[copied] = from
+		}
+		body = append(body, copied)
+	}
+
+	return body
+}
+
+// The label written in the source which the given label was copied from, which is the
+// label itself when it was not expanded from a macro or repetition
+func (a *Assembler) sourceLabel(label *ast.LInstruction) *ast.LInstruction {
+	if source, ok := a.sourceLabels[label]; ok {
+		return source
+	}
+
+	return label
+}
+
+func (m *macroExpander) unknownMacroError(call *ast.MacroCall) *AssemblyError {
+	var names []string
+	for name := range m.macros {
+		names = append(names, name)
+	}
+
+	err := &AssemblyError{
+		Rule:        UnknownMacro,
+		Phase:       EXPAND,
+		Instruction: call,
+		Span:        nodeSpan(call),
+		Message:     fmt.Sprintf("unknown instruction %q", call.Name),
+		Notes:       []string{fmt.Sprintf("%q is neither a computation nor a macro defined with .macro", call.Name)},
+	}
+	if suggestion, ok := closestSymbol(call.Name, names); ok {
+		err.Help = fmt.Sprintf("did you mean %q?", suggestion)
+	}
+
+	return err
+}
+
+func (m *macroExpander) tooDeepError(call *ast.MacroCall) *AssemblyError {
+	err := &AssemblyError{
+		Rule:        MacroTooDeep,
+		Phase:       EXPAND,
+		Instruction: call,
+		Span:        nodeSpan(call),
+		Message:     fmt.Sprintf("macro %q is nested too deeply", call.Name),
+		Notes:       []string{fmt.Sprintf("macro calls can be nested at most %d deep", MaxMacroDepth)},
+	}
+
+	// Explain the cycle which most recently led back to this macro
+	for index := len(m.calls) - 1; index >= 0; index-- {
+		if m.calls[index].Name != call.Name {
+			continue
+		}
+
+		var names []string
+		for _, cycle := range m.calls[index:] {
+			names = append(names, cycle.Name)
+		}
+		names = append(names, call.Name)
+
+		if len(names) == 2 {
+			err.Notes = append(err.Notes, fmt.Sprintf("macro %q calls itself", call.Name))
+		} else {
+			err.Notes = append(err.Notes, fmt.Sprintf("macro %q calls itself through %s", call.Name, strings.Join(names, " -> ")))
+		}
+		break
+	}
+
+	return err
+}
+
+// Adds the call sites of the macros which each error was expanded from. Only the outermost
+// call is shown when macros are nested too deeply, rather than every nested call.
+func (a *Assembler) addMacroCalls(errs ErrorList) {
+	for _, err := range errs {
+		calls := a.expandedFrom[err.Instruction]
+		if err.Rule == MacroTooDeep && len(calls) > 0 {
+			calls = calls[len(calls)-1:]
+		}
+
+		for _, call := range calls {
+			err.Related = append(err.Related, Related{
+				Span:    nodeSpan(call),
+				Message: fmt.Sprintf("in expansion of macro %q called here", call.Name),
+			})
+		}
+	}
+}
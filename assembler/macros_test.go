@@ -0,0 +1,177 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMacros(t *testing.T) {
+	input := `
+	.macro PUSH VALUE
+		@VALUE
+		D=A
+		@SP
+		M=D
+	.endm
+	.macro PUSH_PAIR FIRST, SECOND
+		PUSH FIRST
+		PUSH SECOND*2
+	.endm
+		PUSH_PAIR 1, 2+3
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000001
+		1110110000010000
+		0000000000000000
+		1110001100001000
+		0000000000001010
+		1110110000010000
+		0000000000000000
+		1110001100001000
+	`), result)
+}
+
+func TestMacroLabelsAreUniqueToEachExpansion(t *testing.T) {
+	input := `
+	.macro WAIT_FOR_KEY
+	(LOOP)
+		@KBD
+		D=M
+		@LOOP
+		D;JEQ
+	.endm
+		WAIT_FOR_KEY
+		WAIT_FOR_KEY
+	(LOOP)
+		@LOOP
+		0;JMP
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0110000000000000
+		1111110000010000
+		0000000000000000
+		1110001100000010
+		0110000000000000
+		1111110000010000
+		0000000000000100
+		1110001100000010
+		0000000000001000
+		1110101010000111
+	`), result)
+}
+
+func TestMacroErrors(t *testing.T) {
+	input := `
+	.macro PUSH VALUE
+		@VALUE
+	.endm
+	.macro PUSH
+	.endm
+		PUSH
+		PUHS 1
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, DuplicateMacro, errs[0].Rule)
+	assert.Equal(t, 2, errs[0].Related[0].Span.Start.Line)
+	assert.Equal(t, MacroArgumentCount, errs[1].Rule)
+	assert.Equal(t, `macro "PUSH" expects 1 argument, but was given 0`, errs[1].Message)
+	assert.Equal(t, UnknownMacro, errs[2].Rule)
+	assert.Equal(t, `did you mean "PUSH"?`, errs[2].Help)
+}
+
+func TestRecursiveMacros(t *testing.T) {
+	input := `
+	.macro PING
+		PONG
+	.endm
+	.macro PONG
+		PING
+	.endm
+		PING
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, MacroTooDeep, errs[0].Rule)
+	assert.Equal(t, `macro "PING" is nested too deeply`, errs[0].Message)
+	assert.Equal(t, []string{
+		"macro calls can be nested at most 64 deep",
+		"macro \"PING\" calls itself through PING -> PONG -> PING",
+	}, errs[0].Notes)
+	assert.Len(t, errs[0].Related, 1)
+	assert.Equal(t, 8, errs[0].Related[0].Span.Start.Line)
+}
+
+func TestMacrosWhichCallThemselvesTwice(t *testing.T) {
+	input := `
+	.macro F
+		F
+		F
+	.endm
+		F
+		F
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 2)
+	for _, err := range errs {
+		assert.Equal(t, MacroTooDeep, err.Rule)
+		assert.Equal(t, `macro "F" is nested too deeply`, err.Message)
+	}
+	assert.Equal(t, 6, errs[0].Related[0].Span.Start.Line)
+	assert.Equal(t, 7, errs[1].Related[0].Span.Start.Line)
+}
+
+func TestTooManyExpansions(t *testing.T) {
+	input := `
+	.macro EMPTY
+	.endm
+	.rept 128*256
+	.rept 128*256
+		EMPTY
+	.endr
+	.endr
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, TooManyExpansions, errs[0].Rule)
+	assert.Equal(t, []string{"at most 1048576 macro calls and repetitions can be expanded"}, errs[0].Notes)
+}
+
+func TestErrorsWithinMacrosShowEachCall(t *testing.T) {
+	input := `
+	.macro LOAD VALUE
+		@VALUE
+	.endm
+	.macro LOAD_LAST VALUE
+		LOAD VALUE-1
+	.endm
+		LOAD_LAST 0
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ValueOutOfRange, errs[0].Rule)
+	assert.Equal(t, 3, errs[0].Span.Start.Line)
+	assert.Equal(t, []Related{
+		{Span: errs[0].Related[0].Span, Message: `in expansion of macro "LOAD" called here`},
+		{Span: errs[0].Related[1].Span, Message: `in expansion of macro "LOAD_LAST" called here`},
+	}, errs[0].Related)
+	assert.Equal(t, 6, errs[0].Related[0].Span.Start.Line)
+	assert.Equal(t, 8, errs[0].Related[1].Span.Start.Line)
+}
@@ -0,0 +1,202 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/symboltable"
+	"github.com/alanfoster/assembler/token"
+)
+
+type moduleResolver struct {
+	// The .module directives of each file, which are in source order as each file is only included once
+	directives map[string][]*ast.ModuleDirective
+	modules    symboltable.Modules
+	// The labels, variables and constants defined outside of any module, which every module can see
+	globals map[string]bool
+	errs    ErrorList
+}
+
+// Names each label, declared variable and constant within a module after the module, such
+// as Foo.x, along with every reference to them. This mirrors the File.symbol naming of
+// the VM translator, without writing out each prefix.
+//
+// A .module directive applies until the end of its file. Each symbol belongs to the module
+// of the file it was written in, so the symbols within a macro belong to the module that
+// defines the macro, whereas its arguments belong to the module which calls it. Variables
+// allocated on their first use within a module also belong to it. Within a module, a symbol
+// refers to the module's own symbol when one exists, and otherwise to the symbol outside of
+// any module. Symbols of other modules are only reached by their qualified name.
+func (a *Assembler) resolveModules(program ast.Program) (ast.Program, ErrorList) {
+	r := &moduleResolver{
+		directives: map[string][]*ast.ModuleDirective{},
+		modules:    symboltable.Modules{},
+		globals:    map[string]bool{},
+	}
+	for name := range a.Constants {
+		r.globals[name] = true
+	}
+
+	var instructions []ast.Instruction
+	for _, instruction := range program.Instructions {
+		if directive, ok := instruction.(*ast.ModuleDirective); ok {
+			file := directive.Span.Start.File
+			r.directives[file] = append(r.directives[file], directive)
+			r.modules.Add(directive.Name)
+			continue
+		}
+		instructions = append(instructions, instruction)
+	}
+	if len(r.modules) == 0 {
+		return program, nil
+	}
+
+	r.define(instructions)
+	r.allocate(instructions)
+
+	for _, instruction := range instructions {
+		replace := func(variable *ast.Variable) ast.AInstructionValue {
+			return r.reference(instruction, variable)
+		}
+
+		switch instruction := instruction.(type) {
+		case *ast.AInstruction:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		case *ast.ConstantDirective:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		case *ast.LoadInstruction:
+			instruction.Value = ast.ReplaceVariables(instruction.Value, replace)
+		}
+	}
+
+	return ast.Program{Instructions: instructions}, r.errs
+}
+
+// The module which the source at the given position belongs to, if any
+func (r *moduleResolver) moduleAt(pos token.Pos) string {
+	module := ""
+	for _, directive := range r.directives[pos.File] {
+		if directive.Span.Start.Offset > pos.Offset {
+			break
+		}
+		module = directive.Name
+	}
+
+	return module
+}
+
+// Renames each label, declared variable and constant within a module. Local labels are
+// named after their global label once labels are scoped, but are recorded here so that
+// other modules can reference them.
+func (r *moduleResolver) define(instructions []ast.Instruction) {
+	scope := ""
+	for _, instruction := range instructions {
+		var name *string
+		kind := "label"
+
+		switch instruction := instruction.(type) {
+		case *ast.LInstruction:
+			if isLocalLabel(instruction.Value) {
+				if module, local, ok := r.modules.Owner(scope); ok {
+					r.modules.Define(module, local+instruction.Value)
+				}
+				continue
+			}
+			if isGeneratedSymbol(instruction.Value) {
+				continue
+			}
+			name = &instruction.Value
+		case *ast.VarDirective:
+			name, kind = &instruction.Name, "variable"
+		case *ast.ConstantDirective:
+			name, kind = &instruction.Name, "constant"
+		default:
+			continue
+		}
+		// Predefined symbols are never renamed, so that redefining them is still reported
+		if symboltable.IsPredefined(*name) {
+			continue
+		}
+
+		module := r.moduleAt(instruction.Pos())
+		if module == "" {
+			if owner, _, ok := r.modules.Owner(*name); ok {
+				r.errs = append(r.errs, &AssemblyError{
+					Rule:        ForeignModuleSymbol,
+					Phase:       RESOLVE,
+					Instruction: instruction,
+					Span:        nodeSpan(instruction),
+					Message:     fmt.Sprintf("%s %q can only be defined within module %q", kind, *name, owner),
+					Help:        fmt.Sprintf("define it after \".module %s\", or give it a different name", owner),
+				})
+			}
+			r.globals[*name] = true
+		} else {
+			r.modules.Define(module, *name)
+			*name = symboltable.Qualify(module, *name)
+		}
+
+		if kind == "label" {
+			scope = *name
+		}
+	}
+}
+
+// Variables used on their own within a module, which are not otherwise defined, are
+// allocated within the module. They are found before any reference is replaced, so that
+// other modules can reference them regardless of the order of the program.
+func (r *moduleResolver) allocate(instructions []ast.Instruction) {
+	for _, instruction := range instructions {
+		aInstruction, isA := instruction.(*ast.AInstruction)
+		if !isA {
+			continue
+		}
+		variable, isVariable := aInstruction.Value.(*ast.Variable)
+		if !isVariable {
+			continue
+		}
+
+		module := r.moduleAt(variable.Span.Start)
+		if module != "" && r.isModuleVariable(module, variable.Name) {
+			r.modules.Define(module, variable.Name)
+		}
+	}
+}
+
+func (r *moduleResolver) isModuleVariable(module string, name string) bool {
+	if r.modules.Defines(module, name) || r.globals[name] || symboltable.IsPredefined(name) {
+		return false
+	}
+
+	// Qualified names, local labels and generated symbols are never new variables of the module
+	return !strings.Contains(name, ".") && !isAnonymousReference(name) && !isGeneratedSymbol(name)
+}
+
+// The full name of the symbol which a reference refers to
+func (r *moduleResolver) reference(instruction ast.Instruction, variable *ast.Variable) ast.AInstructionValue {
+	name := variable.Name
+	if isLocalLabel(name) || isAnonymousReference(name) || isGeneratedSymbol(name) {
+		return variable
+	}
+
+	module := r.moduleAt(variable.Span.Start)
+	if module != "" && r.modules.Defines(module, name) {
+		return &ast.Variable{Name: symboltable.Qualify(module, name), Span: variable.Span}
+	}
+
+	if owner, local, ok := r.modules.Owner(name); ok {
+		if !r.modules.Defines(owner, local) {
+			r.errs = append(r.errs, &AssemblyError{
+				Rule:        UndefinedModuleSymbol,
+				Phase:       RESOLVE,
+				Instruction: instruction,
+				Span:        nodeSpan(variable),
+				Message:     fmt.Sprintf("module %q does not define %q", owner, local),
+				Notes:       []string{"symbols of another module must be defined by it, and are never allocated from outside of it"},
+			})
+		}
+	}
+
+	return variable
+}
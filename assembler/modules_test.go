@@ -0,0 +1,75 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModules(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"a.asm": ".module A\n@x\n(start)\n@start\n",
+		"b.asm": ".module B\n@x\n@A.start\n",
+	})
+	result, err := a.ConvertFile("main.asm", ".include \"a.asm\"\n.include \"b.asm\"\n@A.x\n@B.x\n@x\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000010000
+		0000000000000001
+		0000000000010001
+		0000000000000001
+		0000000000010000
+		0000000000010001
+		0000000000010010
+	`), result)
+}
+
+func TestModulesSeeSymbolsOutsideAnyModule(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"a.asm": ".module A\n.equ SIZE 8\n@SIZE\n@LOOP\n@R13\n",
+	})
+	result, err := a.ConvertFile("main.asm", ".equ SIZE 4\n.include \"a.asm\"\n(LOOP)\n@SIZE\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000001000
+		0000000000000011
+		0000000000001101
+		0000000000000100
+	`), result)
+}
+
+func TestModulesWithinMacros(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"lib.asm": ".module Lib\n.macro STORE VALUE\n@VALUE\nD=M\n@tmp\nM=D\n.endm\n",
+	})
+	result, err := a.ConvertFile("main.asm", ".include \"lib.asm\"\n@tmp\nSTORE tmp\n")
+
+	// The argument belongs to the caller, whereas the body belongs to the module defining the macro
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000010000
+		0000000000010000
+		1111110000010000
+		0000000000010001
+		1110001100001000
+	`), result)
+}
+
+func TestModuleErrors(t *testing.T) {
+	a := withFiles(New(), map[string]string{
+		"a.asm": ".module A\n@x\n",
+	})
+	_, err := a.ConvertFile("main.asm", ".include \"a.asm\"\n(A.y)\n@A.z\n@A.x\n")
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 2)
+
+	assert.Equal(t, ForeignModuleSymbol, errs[0].Rule)
+	assert.Equal(t, `label "A.y" can only be defined within module "A"`, errs[0].Message)
+
+	assert.Equal(t, UndefinedModuleSymbol, errs[1].Rule)
+	assert.Equal(t, `module "A" does not define "z"`, errs[1].Message)
+	assert.Equal(t, 3, errs[1].Span.Start.Line)
+}
@@ -0,0 +1,61 @@
+package assembler
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// The most times that a block can be repeated, which is enough to fill ROM
+const MaxRepeatCount = symboltable.ROMSize
+
+// Expands the body of a .rept block once for each iteration. Like a macro, each
+// iteration has its own labels, and the counter is replaced with the iteration number.
+func (m *macroExpander) repeat(directive *ast.RepeatDirective) []ast.Instruction {
+	count, err := m.conditions.evaluate(directive, directive.Count, InvalidRepeatCount, "repeat count")
+	if err != nil {
+		m.errs = append(m.errs, err)
+		return nil
+	}
+	if count < 0 || count > MaxRepeatCount {
+		m.errs = append(m.errs, &AssemblyError{
+			Rule:        InvalidRepeatCount,
+			Phase:       EXPAND,
+			Instruction: directive,
+			Span:        nodeSpan(directive.Count),
+			Message:     fmt.Sprintf("repeat count %d is out of range", count),
+			Notes:       []string{fmt.Sprintf("blocks can be repeated 0 to %d times", MaxRepeatCount)},
+		})
+		return nil
+	}
+
+	var expanded []ast.Instruction
+	for iteration := 0; iteration < count && m.canExpand(directive); iteration++ {
+		args := map[string]ast.AInstructionValue{}
+		if directive.Counter != "" {
+			args[directive.Counter] = &ast.Number{Value: iteration, Span: nodeSpan(directive.Count)}
+		}
+
+		body := m.substitute(directive.Body, "rept", args, m.a.expandedFrom[directive])
+		expanded = append(expanded, m.nested(body)...)
+	}
+
+	return expanded
+}
+
+// Expands the body of an .irp block once for each of its values
+func (m *macroExpander) iterate(directive *ast.IterateDirective) []ast.Instruction {
+	var expanded []ast.Instruction
+	for _, value := range directive.Values {
+		if !m.canExpand(directive) {
+			break
+		}
+
+		args := map[string]ast.AInstructionValue{directive.Name: value}
+		body := m.substitute(directive.Body, "irp", args, m.a.expandedFrom[directive])
+		expanded = append(expanded, m.nested(body)...)
+	}
+
+	return expanded
+}
@@ -0,0 +1,148 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepeat(t *testing.T) {
+	input := `
+	.equ ROWS 3
+	.rept ROWS, ROW
+		@SCREEN+ROW*32
+		M=0
+	.endr
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0100000000000000
+		1110101010001000
+		0100000000100000
+		1110101010001000
+		0100000001000000
+		1110101010001000
+	`), result)
+}
+
+func TestRepeatLabelsAreUniqueToEachIteration(t *testing.T) {
+	input := `
+	.rept 2
+	(WAIT)
+		@WAIT
+		0;JMP
+	.endr
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000000
+		1110101010000111
+		0000000000000010
+		1110101010000111
+	`), result)
+}
+
+func TestIterate(t *testing.T) {
+	input := `
+	.irp REGISTER, R13, R14+1
+		@REGISTER
+		M=0
+	.endr
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000001101
+		1110101010001000
+		0000000000001111
+		1110101010001000
+	`), result)
+}
+
+func TestNestedRepetitionsWithinMacro(t *testing.T) {
+	input := `
+	.macro TABLE SIZE
+	.rept SIZE, I
+		.rept 2, J
+			.if I == J
+				@I
+			.endif
+		.endr
+	.endr
+	.endm
+		TABLE 3
+	`
+	result, err := New().Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, removeWhitespace(`
+		0000000000000000
+		0000000000000001
+	`), result)
+}
+
+func TestRepeatCountCanFillROM(t *testing.T) {
+	input := `
+	.rept 128*256
+	.endr
+	`
+	_, err := New().Convert(input)
+
+	assert.NoError(t, err)
+}
+
+func TestNestedRepetitionsWhichCanNotFitInROM(t *testing.T) {
+	input := `
+	.rept 128*256
+	.rept 128*256
+		@R0
+	.endr
+	.endr
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ROMOverflow, errs[0].Rule)
+	assert.Equal(t, "macros and repetitions produce more instructions than ROM can hold", errs[0].Message)
+	assert.Equal(t, 4, errs[0].Span.Start.Line)
+}
+
+func TestRepeatErrors(t *testing.T) {
+	input := `
+	.rept -1
+	.endr
+	.rept LOOP
+	.endr
+	.macro FILL COUNT
+	.rept COUNT
+		.error "too many"
+	.endr
+	.endm
+		FILL 200*200
+		FILL 1
+	(LOOP)
+	`
+	_, err := New().Convert(input)
+
+	errs := err.(ErrorList)
+	assert.Len(t, errs, 4)
+
+	assert.Equal(t, InvalidRepeatCount, errs[0].Rule)
+	assert.Equal(t, "repeat count -1 is out of range", errs[0].Message)
+	assert.Equal(t, []string{"blocks can be repeated 0 to 32768 times"}, errs[0].Notes)
+
+	assert.Equal(t, InvalidRepeatCount, errs[1].Rule)
+	assert.Equal(t, `undefined symbol "LOOP" in repeat count`, errs[1].Message)
+
+	assert.Equal(t, "repeat count 40000 is out of range", errs[2].Message)
+	assert.Equal(t, 11, errs[2].Related[0].Span.Start.Line)
+
+	assert.Equal(t, "too many", errs[3].Message)
+	assert.Equal(t, 12, errs[3].Related[0].Span.Start.Line)
+}
@@ -0,0 +1,273 @@
+package assembler
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// Hands out RAM addresses to variables, from the variable base up until the ceiling
+type allocator struct {
+	next    int
+	ceiling int
+	// Addresses fixed by declarations, which are never handed out to other variables
+	reserved map[int]bool
+
+	// The number of variables given a fixed address, allocated an address, or which did not fit
+	fixed     int
+	allocated int
+	failed    int
+
+	// The error for the first variable which did not fit, which is reported once for all variables
+	exhausted *AssemblyError
+}
+
+// Allocates the next free address to the given variable. An error is returned for the first
+// variable which does not fit, the remainder are counted and summarized afterwards.
+func (al *allocator) allocate(st symboltable.SymbolTable, instruction ast.Instruction, name string) *AssemblyError {
+	for al.reserved[al.next] {
+		al.next++
+	}
+
+	if al.next >= al.ceiling {
+		// The variable is still added, so that it is not reported again on its next use
+		st.Add(name, symboltable.VARIABLE, al.ceiling)
+		al.failed++
+		if al.exhausted != nil {
+			return nil
+		}
+		al.exhausted = ramExhaustedError(instruction, name, al.ceiling)
+		return al.exhausted
+	}
+
+	st.Add(name, symboltable.VARIABLE, al.next)
+	al.next++
+	al.allocated++
+	return nil
+}
+
+// Explains how much RAM was used when variables did not fit
+func (al *allocator) summarize() {
+	if al.exhausted == nil {
+		return
+	}
+
+	al.exhausted.Notes = []string{
+		fmt.Sprintf("%s allocated at addresses %d to %d", count(al.allocated, "variable was", "variables were"), symboltable.VariableBase, al.ceiling-1),
+		fmt.Sprintf("%s not be allocated", count(al.failed, "variable could", "variables could")),
+	}
+}
+
+// Adds each variable declared with .var to the symbol table. Variables with a fixed address
+// are added first, so that the remaining variables can be allocated around them.
+func (a *Assembler) declareVariables(program ast.Program, st symboltable.SymbolTable) (*allocator, ErrorList) {
+	al := &allocator{
+		next:     symboltable.VariableBase,
+		ceiling:  a.variableCeiling(),
+		reserved: map[int]bool{},
+	}
+	var errs ErrorList
+	declarations := map[string]*ast.VarDirective{}
+	addresses := map[int]*ast.VarDirective{}
+	var pending []*ast.VarDirective
+
+	for _, instruction := range program.Instructions {
+		declaration, ok := instruction.(*ast.VarDirective)
+		if !ok {
+			continue
+		}
+
+		if symboltable.IsPredefined(declaration.Name) {
+			errs = append(errs, &AssemblyError{
+				Rule:        PredefinedVariable,
+				Phase:       RESOLVE,
+				Instruction: declaration,
+				Span:        nodeSpan(declaration),
+				Message:     fmt.Sprintf("variable %q redefines a predefined symbol", declaration.Name),
+				Notes:       []string{fmt.Sprintf("%s is predefined as address %d", declaration.Name, st.Get(declaration.Name))},
+			})
+			continue
+		}
+
+		if previous, ok := declarations[declaration.Name]; ok {
+			errs = append(errs, &AssemblyError{
+				Rule:        DuplicateVariable,
+				Phase:       RESOLVE,
+				Instruction: declaration,
+				Span:        nodeSpan(declaration),
+				Message:     fmt.Sprintf("variable %q is already declared", declaration.Name),
+				Related: []Related{
+					{Span: nodeSpan(previous), Message: fmt.Sprintf("variable %q was first declared here", declaration.Name)},
+				},
+			})
+			continue
+		}
+
+		// Only labels and constants have been added to the symbol table at this point
+		if st.Contains(declaration.Name) {
+			errs = append(errs, &AssemblyError{
+				Rule:        DuplicateVariable,
+				Phase:       RESOLVE,
+				Instruction: declaration,
+				Span:        nodeSpan(declaration),
+				Message:     fmt.Sprintf("variable %q is already defined as a %s", declaration.Name, st.Kind(declaration.Name)),
+			})
+			continue
+		}
+		declarations[declaration.Name] = declaration
+
+		if declaration.Address == nil {
+			pending = append(pending, declaration)
+			continue
+		}
+
+		address := declaration.Address.Value
+		if address >= al.ceiling {
+			errs = append(errs, fixedAddressError(declaration, address, al.ceiling))
+			continue
+		}
+		if previous, ok := addresses[address]; ok {
+			errs = append(errs, &AssemblyError{
+				Rule:        VariableAddressConflict,
+				Phase:       RESOLVE,
+				Instruction: declaration,
+				Span:        nodeSpan(declaration),
+				Message:     fmt.Sprintf("variable %q shares address %d with variable %q", declaration.Name, address, previous.Name),
+				Related: []Related{
+					{Span: nodeSpan(previous), Message: fmt.Sprintf("variable %q was declared here", previous.Name)},
+				},
+			})
+			continue
+		}
+		addresses[address] = declaration
+
+		st.Add(declaration.Name, symboltable.VARIABLE, address)
+		al.reserved[address] = true
+		al.fixed++
+	}
+
+	for _, declaration := range pending {
+		if err := al.allocate(st, declaration, declaration.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return al, errs
+}
+
+// The exclusive upper bound for variable addresses, which can never exceed the start of the screen
+func (a *Assembler) variableCeiling() int {
+	if a.VariableCeiling <= 0 || a.VariableCeiling > symboltable.ScreenBase {
+		return symboltable.ScreenBase
+	}
+
+	return a.VariableCeiling
+}
+
+func ramExhaustedError(instruction ast.Instruction, name string, ceiling int) *AssemblyError {
+	message := fmt.Sprintf(
+		"not enough RAM for variable %q, it would be allocated at address %d which is the start of the screen",
+		name,
+		ceiling,
+	)
+	if ceiling != symboltable.ScreenBase {
+		message = fmt.Sprintf(
+			"not enough RAM for variable %q, it would be allocated at address %d which is beyond the variable ceiling",
+			name,
+			ceiling,
+		)
+	}
+
+	return &AssemblyError{
+		Rule:        RAMExhausted,
+		Phase:       RESOLVE,
+		Instruction: instruction,
+		Span:        nodeSpan(instruction),
+		Message:     message,
+	}
+}
+
+// A fixed address must be below the screen, and the variable ceiling, in the same way as allocated variables
+func fixedAddressError(declaration *ast.VarDirective, address int, ceiling int) *AssemblyError {
+	var reason string
+	switch {
+	case address > symboltable.KeyboardAddress:
+		reason = "beyond the end of RAM"
+	case address == symboltable.KeyboardAddress:
+		reason = "the memory mapped keyboard"
+	case address >= symboltable.ScreenBase:
+		reason = "within the memory mapped screen"
+	default:
+		reason = fmt.Sprintf("beyond the variable ceiling of %d", ceiling)
+	}
+
+	return &AssemblyError{
+		Rule:        VariableAddressOutOfRange,
+		Phase:       RESOLVE,
+		Instruction: declaration,
+		Span:        nodeSpan(declaration),
+		Message:     fmt.Sprintf("variable %q is at address %d, which is %s", declaration.Name, address, reason),
+		Notes:       []string{fmt.Sprintf("variables can use addresses 0 to %d", ceiling-1)},
+	}
+}
+
+// In strict mode every variable must be declared, so any unknown symbol is likely a typo
+func undeclaredError(instruction ast.Instruction, value ast.AInstructionValue, variable *ast.Variable, st symboltable.SymbolTable) *AssemblyError {
+	var symbols []string
+	for name := range st {
+		symbols = append(symbols, name)
+	}
+	suggestion, _ := closestSymbol(variable.Name, symbols)
+
+	// Point at the symbol itself when it is part of a larger expression
+	span := nodeSpan(instruction)
+	if value != ast.AInstructionValue(variable) {
+		span = nodeSpan(variable)
+	}
+
+	err := &AssemblyError{
+		Rule:        UndeclaredSymbol,
+		Phase:       RESOLVE,
+		Instruction: instruction,
+		Span:        span,
+		Message:     fmt.Sprintf("symbol %q is not declared", variable.Name),
+		Notes:       []string{fmt.Sprintf("variables must be declared with \".var %s\" in strict mode", variable.Name)},
+	}
+	if suggestion != "" {
+		err.Help = fmt.Sprintf("did you mean %q?", suggestion)
+	}
+
+	return err
+}
+
+// Variables are only allocated when used on their own, so expressions may only refer to
+// variables which have already been allocated. Unlike labels, their address is not yet known.
+func (a *Assembler) unresolvedSymbols(instruction ast.Instruction, value ast.AInstructionValue, st symboltable.SymbolTable) ErrorList {
+	var errs ErrorList
+	reported := map[string]bool{}
+
+	for _, variable := range ast.Variables(value) {
+		if st.Contains(variable.Name) || reported[variable.Name] {
+			continue
+		}
+		reported[variable.Name] = true
+
+		if a.Strict {
+			errs = append(errs, undeclaredError(instruction, value, variable, st))
+			continue
+		}
+
+		errs = append(errs, &AssemblyError{
+			Rule:        UnallocatedVariable,
+			Phase:       RESOLVE,
+			Instruction: instruction,
+			Span:        nodeSpan(variable),
+			Message:     fmt.Sprintf("expression uses variable %q before it has been allocated", variable.Name),
+			Help:        fmt.Sprintf("declare the variable with \".var %s\"", variable.Name),
+			Notes:       []string{fmt.Sprintf("variables are allocated when first used on their own, such as \"@%s\"", variable.Name)},
+		})
+	}
+
+	return errs
+}
@@ -0,0 +1,222 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/suggest"
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// Identifiers for each warning, which are stable for use with command line flags and tooling
+const (
+	UnusedLabel       = "unused-label"
+	SingleUseVariable = "single-use-variable"
+	LabelNotJumpedTo  = "label-not-jumped-to"
+	MisspelledSymbol  = "misspelled-symbol"
+)
+
+type WarningInfo struct {
+	ID          string
+	Description string
+	// Whether the warning is reported when it has not been explicitly enabled or disabled
+	Enabled bool
+}
+
+// Every warning that the assembler can report
+var KnownWarnings = []WarningInfo{
+	{UnusedLabel, "a label is defined but never referenced", true},
+	{SingleUseVariable, "a variable is only referenced once, which is often a misspelling", true},
+	{LabelNotJumpedTo, "a label is referenced, but never used as the target of a jump", false},
+	{MisspelledSymbol, "a variable is named similarly to a label or predefined symbol", true},
+}
+
+// Reports whether the given identifier is a known warning
+func IsWarning(id string) bool {
+	for _, warning := range KnownWarnings {
+		if warning.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Looks for likely mistakes within a program which has otherwise assembled successfully
+func (a *Assembler) analyze(program ast.Program, st symboltable.SymbolTable) ErrorList {
+	var labels []*ast.LInstruction
+	declared := map[string]bool{}
+	var variables []string
+	references := map[string][]ast.Instruction{}
+	jumpedTo := map[string]bool{}
+	// The position of each instruction, so that warnings are ordered as the program is,
+	// even when its instructions come from several files
+	positions := map[ast.Instruction]int{}
+
+	// The symbol loaded by the most recent A instruction, which is jumped to when
+	// the next C instruction jumps
+	loaded := ""
+
+	for index, instruction := range program.Instructions {
+		positions[instruction] = index
+		switch instruction := instruction.(type) {
+		case *ast.LInstruction:
+			labels = append(labels, instruction)
+		case *ast.VarDirective:
+			declared[instruction.Name] = true
+		case *ast.ConstantDirective:
+			for _, variable := range ast.Variables(instruction.Value) {
+				references[variable.Name] = append(references[variable.Name], instruction)
+			}
+		case *ast.AInstruction:
+			loaded = ""
+			for _, variable := range ast.Variables(instruction.Value) {
+				if _, seen := references[variable.Name]; !seen {
+					variables = append(variables, variable.Name)
+				}
+				references[variable.Name] = append(references[variable.Name], instruction)
+			}
+			// Only a symbol on its own is the target of a jump, rather than an offset from it
+			if variable, ok := instruction.Value.(*ast.Variable); ok {
+				loaded = variable.Name
+			}
+		case *ast.LoadInstruction:
+			loaded = ""
+			for _, variable := range ast.Variables(instruction.Value) {
+				references[variable.Name] = append(references[variable.Name], instruction)
+			}
+			// Loading a label into A is equivalent to an A-instruction, i.e. A=#LOOP
+			if variable, ok := instruction.Value.(*ast.Variable); ok && instruction.Destination.Value == "A" {
+				loaded = variable.Name
+			}
+		case *ast.CInstruction:
+			if instruction.Jump != nil && loaded != "" {
+				jumpedTo[loaded] = true
+			}
+			loaded = ""
+		}
+	}
+
+	var warnings ErrorList
+	// Each copy of a label within a macro or repetition is reported once, at its definition
+	// and by the name it was written with, rather than by the name generated for each copy
+	reported := map[*ast.LInstruction]bool{}
+	for _, label := range labels {
+		source := a.sourceLabel(label)
+		if reported[source] {
+			continue
+		}
+		if source != label {
+			positions[source] = positions[label]
+		}
+
+		if len(references[label.Value]) == 0 {
+			warnings = a.warn(warnings, UnusedLabel, source, fmt.Sprintf("%s is never used", describeLabel(source.Value)))
+			reported[source] = true
+		} else if !jumpedTo[label.Value] {
+			warnings = a.warn(warnings, LabelNotJumpedTo, source, fmt.Sprintf("%s is never jumped to", describeLabel(source.Value)))
+			reported[source] = true
+		}
+	}
+
+	// The symbols which a misspelled variable may have been intended to be, in order of preference
+	candidates := []symbolNames{
+		{symboltable.LABEL, st.Names(symboltable.LABEL)},
+		{symboltable.CONSTANT, st.Names(symboltable.CONSTANT)},
+		{symboltable.PREDEFINED, st.Names(symboltable.PREDEFINED)},
+	}
+
+	for _, name := range variables {
+		// Declared variables are deliberate, and so are never considered a mistake
+		if st.Kind(name) != symboltable.VARIABLE || declared[name] {
+			continue
+		}
+
+		// A misspelling explains a single use, so only the more specific warning is reported
+		if kind, symbol, ok := misspelling(name, candidates); ok {
+			if a.EnabledWarnings[MisspelledSymbol] {
+				warning := newWarning(MisspelledSymbol, references[name][0], fmt.Sprintf("variable %q is similar to the %s %q", name, kind, symbol))
+				warning.Help = fmt.Sprintf("did you mean %q?", symbol)
+				warning.Notes = []string{fmt.Sprintf("%q is not defined, so it will be allocated as a new variable in RAM", name)}
+				warnings = append(warnings, warning)
+				continue
+			}
+		}
+
+		if len(references[name]) == 1 {
+			warnings = a.warn(warnings, SingleUseVariable, references[name][0], fmt.Sprintf("variable %q is only referenced once", name))
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return positions[warnings[i].Instruction] < positions[warnings[j].Instruction]
+	})
+
+	return warnings
+}
+
+// The names of every symbol of a single kind
+type symbolNames struct {
+	kind  symboltable.Kind
+	names []string
+}
+
+// Finds the label, constant or predefined symbol that a variable was likely intended to be
+func misspelling(variable string, candidates []symbolNames) (kind symboltable.Kind, symbol string, ok bool) {
+	for _, candidate := range candidates {
+		symbol, ok := closestSymbol(variable, candidate.names)
+		if ok && !(candidate.kind == symboltable.PREDEFINED && isNumberedAfter(variable, symbol)) {
+			return candidate.kind, symbol, true
+		}
+	}
+
+	return 0, "", false
+}
+
+// Finds the symbol closest to the given name. Symbols which differ only in case are
+// preferred over those within a small edit distance.
+func closestSymbol(name string, symbols []string) (string, bool) {
+	var candidates []string
+	for _, symbol := range symbols {
+		// Generated labels can not be written in the source, and so are never suggested
+		if !isGeneratedSymbol(symbol) {
+			candidates = append(candidates, symbol)
+		}
+	}
+
+	return suggest.ClosestName(name, candidates)
+}
+
+// Names such as KBD1 or THAT2 number their own variables, rather than misspelling KBD or
+// THAT. R16 still extends the number of R1, and so is likely meant to be a register.
+func isNumberedAfter(name string, symbol string) bool {
+	suffix := strings.TrimPrefix(name, symbol)
+	if suffix == name || suffix == "" || strings.Trim(suffix, "0123456789") != "" {
+		return false
+	}
+
+	last := symbol[len(symbol)-1]
+	return last < '0' || last > '9'
+}
+
+// Adds the warning to the list, unless the warning has been disabled
+func (a *Assembler) warn(warnings ErrorList, id string, instruction ast.Instruction, message string) ErrorList {
+	if !a.EnabledWarnings[id] {
+		return warnings
+	}
+
+	return append(warnings, newWarning(id, instruction, message))
+}
+
+func newWarning(id string, instruction ast.Instruction, message string) *AssemblyError {
+	return &AssemblyError{
+		Rule:        id,
+		Severity:    WARNING,
+		Phase:       ANALYZE,
+		Instruction: instruction,
+		Span:        nodeSpan(instruction),
+		Message:     message,
+	}
+}
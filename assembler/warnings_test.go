@@ -0,0 +1,189 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func messages(warnings ErrorList) []string {
+	var messages []string
+	for _, warning := range warnings {
+		messages = append(messages, warning.Error())
+	}
+	return messages
+}
+
+func TestNoWarnings(t *testing.T) {
+	input := `
+		@i
+		M=0
+	(LOOP)
+		@i
+		M=M+1
+		@LOOP
+		0;JMP
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestDefaultWarnings(t *testing.T) {
+	input := `
+	(START)
+		@counter
+		M=0
+	(TABLE)
+		@TABLE
+		D=A
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`2:2: analyze warning: (START): label "START" is never used`,
+		`3:3: analyze warning: @counter: variable "counter" is only referenced once`,
+	}, messages(a.Warnings()))
+	assert.Equal(t, WARNING, a.Warnings()[0].Severity)
+	assert.Equal(t, UnusedLabel, a.Warnings()[0].Rule)
+}
+
+func TestEnablingAndDisablingWarnings(t *testing.T) {
+	input := `
+	(START)
+		@counter
+		M=0
+	(TABLE)
+		@TABLE
+		D=A
+	`
+	a := New()
+	a.EnabledWarnings[UnusedLabel] = false
+	a.EnabledWarnings[LabelNotJumpedTo] = true
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`3:3: analyze warning: @counter: variable "counter" is only referenced once`,
+		`5:2: analyze warning: (TABLE): label "TABLE" is never jumped to`,
+	}, messages(a.Warnings()))
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	input := `
+	(START)
+		@0
+		0;JMP
+	`
+	a := New()
+	a.WarningsAsErrors = true
+	result, err := a.Convert(input)
+
+	assert.Equal(t, "", result)
+	assert.EqualError(t, err, `2:2: analyze error: (START): label "START" is never used`)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestWarningsAreNotReportedWithErrors(t *testing.T) {
+	a := New()
+	_, err := a.Convert("(START)\nD=D+D")
+
+	assert.Error(t, err)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestMisspelledSymbols(t *testing.T) {
+	input := `
+	(LOOP)
+		@LOPP
+		0;JMP
+		@loop
+		0;JMP
+		@kbd
+		D=M
+		@R16
+		M=D
+		@LOOP
+		0;JMP
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`3:3: analyze warning: @LOPP: variable "LOPP" is similar to the label "LOOP" (did you mean "LOOP"?)`,
+		`5:3: analyze warning: @loop: variable "loop" is similar to the label "LOOP" (did you mean "LOOP"?)`,
+		`7:3: analyze warning: @kbd: variable "kbd" is similar to the predefined symbol "KBD" (did you mean "KBD"?)`,
+		`9:3: analyze warning: @R16: variable "R16" is similar to the predefined symbol "R1" (did you mean "R1"?)`,
+	}, messages(a.Warnings()))
+	assert.Equal(t, MisspelledSymbol, a.Warnings()[0].Rule)
+	assert.Equal(t, []string{`"LOPP" is not defined, so it will be allocated as a new variable in RAM`}, a.Warnings()[0].Notes)
+}
+
+func TestShortAndNumberedVariablesAreNotMisspellings(t *testing.T) {
+	input := `
+	(X)
+		@x1
+		M=0
+		@y
+		M=0
+		@KBD1
+		M=0
+		@THAT2
+		M=0
+		@ARG2
+		M=0
+		@X
+		0;JMP
+	`
+	a := New()
+	a.EnabledWarnings[SingleUseVariable] = false
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestDistinctVariablesAreNotMisspellings(t *testing.T) {
+	input := `
+	(LOOP)
+		@counter
+		M=M+1
+		@counter
+		D=M
+		@LOOP
+		0;JMP
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Empty(t, a.Warnings())
+}
+
+func TestLabelsWithinExpansionsAreReportedOnceByName(t *testing.T) {
+	input := `
+	.rept 3
+	(L)
+		@R0
+	.endr
+	.macro MARK
+	(INNER)
+	.endm
+		MARK
+		MARK
+	`
+	a := New()
+	_, err := a.Convert(input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`3:2: analyze warning: (L): label "L" is never used`,
+		`7:2: analyze warning: (INNER): label "INNER" is never used`,
+	}, messages(a.Warnings()))
+	assert.Empty(t, a.Warnings()[1].Related)
+}
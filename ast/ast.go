@@ -4,10 +4,17 @@ import (
 	"fmt"
 	"bytes"
 	"strconv"
+	"github.com/alanfoster/assembler/token"
+	"strings"
 )
 
 type Node interface {
 	fmt.Stringer
+
+	// The position of the first character belonging to the node
+	Pos() token.Pos
+	// The position directly after the last character belonging to the node
+	End() token.Pos
 }
 
 type Instruction interface {
@@ -28,6 +35,7 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// The value of an A-instruction, which is an expression of numbers and symbols
 type AInstructionValue interface {
 	Node
 }
@@ -35,8 +43,12 @@ type AInstructionValue interface {
 type Number struct {
 	AInstructionValue
 	Value int
+	Span  token.Span
 }
 
+func (c Number) Pos() token.Pos { return c.Span.Start }
+func (c Number) End() token.Pos { return c.Span.End }
+
 func (c Number) String() string {
 	return strconv.Itoa(c.Value)
 }
@@ -44,8 +56,12 @@ func (c Number) String() string {
 type Variable struct {
 	AInstructionValue
 	Name string
+	Span token.Span
 }
 
+func (v Variable) Pos() token.Pos { return v.Span.Start }
+func (v Variable) End() token.Pos { return v.Span.End }
+
 func (v Variable) String() string {
 	return v.Name
 }
@@ -55,8 +71,12 @@ type AInstruction struct {
 	Instruction
 
 	Value AInstructionValue
+	Span  token.Span
 }
 
+func (a *AInstruction) Pos() token.Pos { return a.Span.Start }
+func (a *AInstruction) End() token.Pos { return a.Span.End }
+
 func (a *AInstruction) String() string {
 	return fmt.Sprintf("@%v", a.Value)
 }
@@ -65,8 +85,12 @@ type Value struct {
 	Node
 
 	Value string
+	Span  token.Span
 }
 
+func (v *Value) Pos() token.Pos { return v.Span.Start }
+func (v *Value) End() token.Pos { return v.Span.End }
+
 func (v *Value) String() string {
 	return v.Value
 }
@@ -77,8 +101,12 @@ type Command struct {
 	Node
 
 	Value string
+	Span  token.Span
 }
 
+func (v *Command) Pos() token.Pos { return v.Span.Start }
+func (v *Command) End() token.Pos { return v.Span.End }
+
 func (v *Command) String() string {
 	return v.Value
 }
@@ -90,8 +118,12 @@ type CInstruction struct {
 	Destination *Value
 	Command     Command
 	Jump        *Value
+	Span        token.Span
 }
 
+func (c *CInstruction) Pos() token.Pos { return c.Span.Start }
+func (c *CInstruction) End() token.Pos { return c.Span.End }
+
 func (c *CInstruction) String() string {
 	var out bytes.Buffer
 
@@ -115,8 +147,12 @@ type LInstruction struct {
 	Instruction
 
 	Value string
+	Span  token.Span
 }
 
+func (l *LInstruction) Pos() token.Pos { return l.Span.Start }
+func (l *LInstruction) End() token.Pos { return l.Span.End }
+
 func (l *LInstruction) String() string {
 	var out bytes.Buffer
 
@@ -126,3 +162,503 @@ func (l *LInstruction) String() string {
 
 	return out.String()
 }
+
+// Declares a RAM variable, optionally at a fixed address
+//
+// .var name [address]
+type VarDirective struct {
+	Node
+	Instruction
+
+	Name    string
+	Address *Number
+	Span    token.Span
+}
+
+func (v *VarDirective) Pos() token.Pos { return v.Span.Start }
+func (v *VarDirective) End() token.Pos { return v.Span.End }
+
+func (v *VarDirective) String() string {
+	if v.Address == nil {
+		return fmt.Sprintf(".var %s", v.Name)
+	}
+
+	return fmt.Sprintf(".var %s %v", v.Name, v.Address)
+}
+
+// An operation upon two values, such as SCREEN+32
+type BinaryExpression struct {
+	AInstructionValue
+
+	Operator string
+	Left     AInstructionValue
+	Right    AInstructionValue
+	Span     token.Span
+}
+
+func (b *BinaryExpression) Pos() token.Pos { return b.Span.Start }
+func (b *BinaryExpression) End() token.Pos { return b.Span.End }
+
+func (b *BinaryExpression) String() string {
+	return fmt.Sprintf("%v%s%v", b.Left, b.Operator, b.Right)
+}
+
+// An operation upon a single value, such as -OFFSET
+type UnaryExpression struct {
+	AInstructionValue
+
+	Operator string
+	Operand  AInstructionValue
+	Span     token.Span
+}
+
+func (u *UnaryExpression) Pos() token.Pos { return u.Span.Start }
+func (u *UnaryExpression) End() token.Pos { return u.Span.End }
+
+func (u *UnaryExpression) String() string {
+	return fmt.Sprintf("%s%v", u.Operator, u.Operand)
+}
+
+// An expression wrapped in parentheses, which are kept so that the source can be reproduced
+type ParenExpression struct {
+	AInstructionValue
+
+	Expression AInstructionValue
+	Span       token.Span
+}
+
+func (p *ParenExpression) Pos() token.Pos { return p.Span.Start }
+func (p *ParenExpression) End() token.Pos { return p.Span.End }
+
+func (p *ParenExpression) String() string {
+	return fmt.Sprintf("(%v)", p.Expression)
+}
+
+// Finds every symbol referenced within the given value, in the order they appear
+func Variables(value AInstructionValue) []*Variable {
+	switch value := value.(type) {
+	case *Variable:
+		return []*Variable{value}
+	case *BinaryExpression:
+		return append(Variables(value.Left), Variables(value.Right)...)
+	case *UnaryExpression:
+		return Variables(value.Operand)
+	case *ParenExpression:
+		return Variables(value.Expression)
+	}
+
+	return nil
+}
+
+// Binds a name to a constant value, which is evaluated once every label is known
+//
+// .equ name value
+type ConstantDirective struct {
+	Node
+	Instruction
+
+	// The directive used, either .equ or .define
+	Directive string
+	Name      string
+	Value     AInstructionValue
+	Span      token.Span
+}
+
+func (c *ConstantDirective) Pos() token.Pos { return c.Span.Start }
+func (c *ConstantDirective) End() token.Pos { return c.Span.End }
+
+func (c *ConstantDirective) String() string {
+	return fmt.Sprintf("%s %s %v", c.Directive, c.Name, c.Value)
+}
+
+// Gives another name to a symbol or constant address, such as a scratch register. Aliases
+// after a label belong to it, and so can only be used before the next label.
+//
+// .alias name target
+type AliasDirective struct {
+	Node
+	Instruction
+
+	Name   string
+	Target AInstructionValue
+	Span   token.Span
+}
+
+func (a *AliasDirective) Pos() token.Pos { return a.Span.Start }
+func (a *AliasDirective) End() token.Pos { return a.Span.End }
+
+func (a *AliasDirective) String() string {
+	return fmt.Sprintf(".alias %s %v", a.Name, a.Target)
+}
+
+// Places the symbols defined after it within a module, up until the end of the file.
+// Symbols of a module are named after it, such as Foo.x for the symbol x of module Foo.
+//
+// .module name
+type ModuleDirective struct {
+	Node
+	Instruction
+
+	Name string
+	Span token.Span
+}
+
+func (m *ModuleDirective) Pos() token.Pos { return m.Span.Start }
+func (m *ModuleDirective) End() token.Pos { return m.Span.End }
+
+func (m *ModuleDirective) String() string {
+	return fmt.Sprintf(".module %s", m.Name)
+}
+
+// Includes the instructions of another file in place of the directive
+//
+// .include "path.asm"
+type IncludeDirective struct {
+	Node
+	Instruction
+
+	Path string
+	Span token.Span
+}
+
+func (i *IncludeDirective) Pos() token.Pos { return i.Span.Start }
+func (i *IncludeDirective) End() token.Pos { return i.Span.End }
+
+func (i *IncludeDirective) String() string {
+	return fmt.Sprintf(".include %q", i.Path)
+}
+
+// Defines a macro, whose body is expanded in place of each call. The span covers
+// the .macro line, rather than the whole body.
+//
+// .macro name [param, ...]
+//     body
+// .endm
+type MacroDefinition struct {
+	Node
+	Instruction
+
+	Name   string
+	Params []string
+	Body   []Instruction
+	Span   token.Span
+}
+
+func (m *MacroDefinition) Pos() token.Pos { return m.Span.Start }
+func (m *MacroDefinition) End() token.Pos { return m.Span.End }
+
+func (m *MacroDefinition) String() string {
+	if len(m.Params) == 0 {
+		return fmt.Sprintf(".macro %s", m.Name)
+	}
+
+	return fmt.Sprintf(".macro %s %s", m.Name, strings.Join(m.Params, ", "))
+}
+
+// Expands a macro with the given arguments
+//
+// name [argument, ...]
+type MacroCall struct {
+	Node
+	Instruction
+
+	Name string
+	Args []AInstructionValue
+	Span token.Span
+}
+
+func (m *MacroCall) Pos() token.Pos { return m.Span.Start }
+func (m *MacroCall) End() token.Pos { return m.Span.End }
+
+func (m *MacroCall) String() string {
+	var args []string
+	for _, arg := range m.Args {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return m.Name
+	}
+
+	return fmt.Sprintf("%s %s", m.Name, strings.Join(args, ", "))
+}
+
+// Copies the given value, replacing each symbol with the result of replace. Values
+// which do not contain a replaced symbol may be shared with the original.
+func ReplaceVariables(value AInstructionValue, replace func(*Variable) AInstructionValue) AInstructionValue {
+	switch value := value.(type) {
+	case *Variable:
+		return replace(value)
+	case *BinaryExpression:
+		return &BinaryExpression{
+			Operator: value.Operator,
+			Left:     ReplaceVariables(value.Left, replace),
+			Right:    ReplaceVariables(value.Right, replace),
+			Span:     value.Span,
+		}
+	case *UnaryExpression:
+		return &UnaryExpression{
+			Operator: value.Operator,
+			Operand:  ReplaceVariables(value.Operand, replace),
+			Span:     value.Span,
+		}
+	case *ParenExpression:
+		return &ParenExpression{
+			Expression: ReplaceVariables(value.Expression, replace),
+			Span:       value.Span,
+		}
+	}
+
+	return value
+}
+
+// Loads any 16-bit value into the destination, which the assembler expands into
+// the shortest sequence of real instructions
+//
+// dest=#value
+type LoadInstruction struct {
+	Node
+	Instruction
+
+	Destination *Value
+	Value       AInstructionValue
+	Span        token.Span
+}
+
+func (l *LoadInstruction) Pos() token.Pos { return l.Span.Start }
+func (l *LoadInstruction) End() token.Pos { return l.Span.End }
+
+func (l *LoadInstruction) String() string {
+	return fmt.Sprintf("%v=#%v", l.Destination, l.Value)
+}
+
+// Assembles the body of the first branch whose condition holds. Conditions are evaluated
+// before labels are placed, and so may only refer to constants. The span covers the
+// opening directive, rather than every branch.
+//
+// .if condition | .ifdef name | .ifndef name
+//     body
+// .elif condition
+//     body
+// .else
+//     body
+// .endif
+type ConditionalDirective struct {
+	Node
+	Instruction
+
+	Branches []*ConditionalBranch
+	Span     token.Span
+}
+
+func (c *ConditionalDirective) Pos() token.Pos { return c.Span.Start }
+func (c *ConditionalDirective) End() token.Pos { return c.Span.End }
+
+func (c *ConditionalDirective) String() string {
+	return c.Branches[0].String()
+}
+
+type ConditionalBranch struct {
+	// One of .if, .ifdef, .ifndef, .elif or .else
+	Directive string
+	// The condition of the branch, which is the name of a constant for .ifdef and .ifndef,
+	// and nil for .else
+	Condition AInstructionValue
+	Body      []Instruction
+	// The span of the directive which starts the branch
+	Span token.Span
+	// The region of source from the start of the branch until the directive which ends it
+	Region token.Span
+}
+
+func (c *ConditionalBranch) String() string {
+	if c.Condition == nil {
+		return c.Directive
+	}
+
+	return fmt.Sprintf("%s %v", c.Directive, c.Condition)
+}
+
+// A branch of a conditional which was not assembled. It takes the place of the branch once
+// conditionals are resolved, so that the listing can show the lines which were skipped.
+type SkippedRegion struct {
+	Node
+	Instruction
+
+	Span token.Span
+}
+
+func (s *SkippedRegion) Pos() token.Pos { return s.Span.Start }
+func (s *SkippedRegion) End() token.Pos { return s.Span.End }
+
+// The region ends at the directive which follows the branch, which is not skipped
+func (s *SkippedRegion) String() string {
+	last := s.Span.End.Line - 1
+	if last <= s.Span.Start.Line {
+		return fmt.Sprintf("// line %d skipped", s.Span.Start.Line)
+	}
+
+	return fmt.Sprintf("// lines %d to %d skipped", s.Span.Start.Line, last)
+}
+
+// Stops the program from assembling with the given message, which is useful within a conditional
+//
+// .error "message"
+type ErrorDirective struct {
+	Node
+	Instruction
+
+	Message string
+	Span    token.Span
+}
+
+func (e *ErrorDirective) Pos() token.Pos { return e.Span.Start }
+func (e *ErrorDirective) End() token.Pos { return e.Span.End }
+
+func (e *ErrorDirective) String() string {
+	return fmt.Sprintf(".error %q", e.Message)
+}
+
+// Assembles the body a number of times. The optional counter is replaced by the number
+// of the iteration within the body, starting from 0.
+//
+// .rept count, COUNTER
+//     body
+// .endr
+type RepeatDirective struct {
+	Node
+	Instruction
+
+	Count   AInstructionValue
+	Counter string
+	Body    []Instruction
+	// The span of the opening line, rather than the whole block
+	Span token.Span
+}
+
+func (r *RepeatDirective) Pos() token.Pos { return r.Span.Start }
+func (r *RepeatDirective) End() token.Pos { return r.Span.End }
+
+func (r *RepeatDirective) String() string {
+	if r.Counter == "" {
+		return fmt.Sprintf(".rept %v", r.Count)
+	}
+
+	return fmt.Sprintf(".rept %v, %s", r.Count, r.Counter)
+}
+
+// Assembles the body once for each value, with the name replaced by that value
+//
+// .irp NAME, value, value
+//     body
+// .endr
+type IterateDirective struct {
+	Node
+	Instruction
+
+	Name   string
+	Values []AInstructionValue
+	Body   []Instruction
+	// The span of the opening line, rather than the whole block
+	Span token.Span
+}
+
+func (i *IterateDirective) Pos() token.Pos { return i.Span.Start }
+func (i *IterateDirective) End() token.Pos { return i.Span.End }
+
+func (i *IterateDirective) String() string {
+	parts := []string{i.Name}
+	for _, value := range i.Values {
+		parts = append(parts, value.String())
+	}
+
+	return ".irp " + strings.Join(parts, ", ")
+}
+
+// Compares the result of a computation with 0 when the program runs, such as D-M>0
+type RuntimeCondition struct {
+	Node
+
+	Computation Command
+	// One of <, <=, >, >=, == or !=
+	Operator string
+	Span     token.Span
+}
+
+func (r *RuntimeCondition) Pos() token.Pos { return r.Span.Start }
+func (r *RuntimeCondition) End() token.Pos { return r.Span.End }
+
+func (r *RuntimeCondition) String() string {
+	return fmt.Sprintf("%s%s0", r.Computation.Value, r.Operator)
+}
+
+// Runs the body of the first branch whose condition holds when the program runs. The
+// condition of each branch is a RuntimeCondition, other than for .else.
+//
+// .if D>0
+//     body
+// .elif D==0
+//     body
+// .else
+//     body
+// .endif
+type IfStatement struct {
+	Node
+	Instruction
+
+	Branches []*ConditionalBranch
+	// The span of the opening line, rather than the whole statement
+	Span token.Span
+}
+
+func (i *IfStatement) Pos() token.Pos { return i.Span.Start }
+func (i *IfStatement) End() token.Pos { return i.Span.End }
+
+func (i *IfStatement) String() string {
+	return i.Branches[0].String()
+}
+
+// Runs the body for as long as the condition holds, which is checked before each iteration
+//
+// .while D!=0
+//     body
+// .endwhile
+type WhileStatement struct {
+	Node
+	Instruction
+
+	Condition *RuntimeCondition
+	Body      []Instruction
+	// The span of the opening line, and of the .endwhile which closes it
+	Span    token.Span
+	Closing token.Span
+}
+
+func (w *WhileStatement) Pos() token.Pos { return w.Span.Start }
+func (w *WhileStatement) End() token.Pos { return w.Span.End }
+
+func (w *WhileStatement) String() string {
+	return fmt.Sprintf(".while %v", w.Condition)
+}
+
+// Runs the body the given number of times, counting in RAM so that the body may use any register
+//
+// .loop count
+//     body
+// .endloop
+type LoopStatement struct {
+	Node
+	Instruction
+
+	Count AInstructionValue
+	Body  []Instruction
+	// The span of the opening line, and of the .endloop which closes it
+	Span    token.Span
+	Closing token.Span
+}
+
+func (l *LoopStatement) Pos() token.Pos { return l.Span.Start }
+func (l *LoopStatement) End() token.Pos { return l.Span.End }
+
+func (l *LoopStatement) String() string {
+	return fmt.Sprintf(".loop %v", l.Count)
+}
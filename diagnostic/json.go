@@ -0,0 +1,94 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/alanfoster/assembler/assembler"
+	"github.com/alanfoster/assembler/token"
+)
+
+type jsonReport struct {
+	Diagnostics []jsonDiagnostic `json:"diagnostics"`
+}
+
+type jsonDiagnostic struct {
+	Rule     string        `json:"rule"`
+	Severity string        `json:"severity"`
+	Phase    string        `json:"phase"`
+	File     string        `json:"file"`
+	Start    jsonPosition  `json:"start"`
+	End      jsonPosition  `json:"end"`
+	Message  string        `json:"message"`
+	Help     string        `json:"help,omitempty"`
+	Notes    []string      `json:"notes,omitempty"`
+	Related  []jsonRelated `json:"related,omitempty"`
+	// The include directives which led to the file, innermost first
+	IncludedFrom []jsonLocation `json:"includedFrom,omitempty"`
+}
+
+type jsonLocation struct {
+	File  string       `json:"file"`
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonRelated struct {
+	File    string       `json:"file"`
+	Start   jsonPosition `json:"start"`
+	End     jsonPosition `json:"end"`
+	Message string       `json:"message"`
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// Writes the errors and warnings as a single JSON document, for consumption by other tools
+func WriteJSON(w io.Writer, errs assembler.ErrorList) error {
+	report := jsonReport{Diagnostics: []jsonDiagnostic{}}
+	for _, err := range errs {
+		var related []jsonRelated
+		for _, r := range err.Related {
+			related = append(related, jsonRelated{
+				File:    r.Span.Start.File,
+				Start:   newJSONPosition(r.Span.Start),
+				End:     newJSONPosition(r.Span.End),
+				Message: r.Message,
+			})
+		}
+
+		var includedFrom []jsonLocation
+		for _, span := range err.IncludedFrom {
+			includedFrom = append(includedFrom, jsonLocation{
+				File:  span.Start.File,
+				Start: newJSONPosition(span.Start),
+				End:   newJSONPosition(span.End),
+			})
+		}
+
+		report.Diagnostics = append(report.Diagnostics, jsonDiagnostic{
+			Rule:         err.Rule,
+			Severity:     err.Severity.String(),
+			Phase:        err.Phase.String(),
+			File:         err.Span.Start.File,
+			Start:        newJSONPosition(err.Span.Start),
+			End:          newJSONPosition(err.Span.End),
+			Message:      err.Message,
+			Help:         err.Help,
+			Notes:        err.Notes,
+			Related:      related,
+			IncludedFrom: includedFrom,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func newJSONPosition(pos token.Pos) jsonPosition {
+	return jsonPosition{Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+}
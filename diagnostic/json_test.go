@@ -0,0 +1,85 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alanfoster/assembler/assembler"
+	"github.com/stretchr/testify/assert"
+)
+
+func assemble(t *testing.T, file string, source string) assembler.ErrorList {
+	_, err := assembler.New().ConvertFile(file, source)
+	errs, ok := err.(assembler.ErrorList)
+	assert.True(t, ok)
+	return errs
+}
+
+func TestWriteJSON(t *testing.T) {
+	errs := assemble(t, "max.asm", "@;\n0;JNZ")
+	expected := `{
+  "diagnostics": [
+    {
+      "rule": "unexpected-token",
+      "severity": "error",
+      "phase": "parse",
+      "file": "max.asm",
+      "start": {
+        "line": 1,
+        "column": 2,
+        "offset": 1
+      },
+      "end": {
+        "line": 1,
+        "column": 3,
+        "offset": 2
+      },
+      "message": "expected a number or symbol, instead got: SEMICOLON \";\""
+    },
+    {
+      "rule": "unknown-jump",
+      "severity": "error",
+      "phase": "parse",
+      "file": "max.asm",
+      "start": {
+        "line": 2,
+        "column": 3,
+        "offset": 5
+      },
+      "end": {
+        "line": 2,
+        "column": 6,
+        "offset": 8
+      },
+      "message": "unknown jump \"JNZ\"",
+      "help": "did you mean \"JNE\"?",
+      "notes": [
+        "valid jumps are: JEQ, JGE, JGT, JLE, JLT, JMP, JNE"
+      ]
+    }
+  ]
+}
+`
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteJSON(&out, errs))
+	assert.Equal(t, expected, out.String())
+}
+
+func TestWriteJSONWithoutErrors(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, WriteJSON(&out, nil))
+	assert.Equal(t, "{\n  \"diagnostics\": []\n}\n", out.String())
+}
+
+func TestWriteJSONWarnings(t *testing.T) {
+	a := assembler.New()
+	_, err := a.ConvertFile("max.asm", "(START)\n@0\n0;JMP")
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteJSON(&out, a.Warnings()))
+	assert.Contains(t, out.String(), `"rule": "unused-label"`)
+	assert.Contains(t, out.String(), `"severity": "warning"`)
+	assert.Contains(t, out.String(), `"phase": "analyze"`)
+}
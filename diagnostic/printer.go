@@ -0,0 +1,168 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alanfoster/assembler/assembler"
+	"github.com/alanfoster/assembler/token"
+)
+
+// ANSI escape codes used when colour is enabled
+const (
+	reset   = "\x1b[0m"
+	bold    = "\x1b[1m"
+	red     = "\x1b[1;31m"
+	green   = "\x1b[1;32m"
+	magenta = "\x1b[1;35m"
+	cyan    = "\x1b[1;36m"
+)
+
+// Renders errors and warnings in the style of a modern compiler, for example:
+//
+//	max.asm:2:5: error: unknown computation "D+D"
+//	   2 |   D=D+D
+//	     |     ^~~
+//	help: did you mean "D+1"?
+//
+// Errors within included files are preceded by the chain of includes which led to them.
+type Printer struct {
+	// The contents of each source file by name, used to show the line in error
+	Sources map[string]string
+	// Whether the output should be highlighted with ANSI colour codes
+	Color bool
+}
+
+func NewPrinter(sources map[string]string, color bool) *Printer {
+	return &Printer{
+		Sources: sources,
+		Color:   color,
+	}
+}
+
+func (p *Printer) PrintAll(w io.Writer, errs assembler.ErrorList) {
+	for _, err := range errs {
+		p.Print(w, err)
+	}
+}
+
+func (p *Printer) Print(w io.Writer, err *assembler.AssemblyError) {
+	severity := p.paint(red, "error:")
+	if err.Severity == assembler.WARNING {
+		severity = p.paint(magenta, "warning:")
+	}
+	// The innermost include is printed first, as in the output of C compilers
+	for index, span := range err.IncludedFrom {
+		prefix, suffix := "In file included from", ","
+		if index > 0 {
+			prefix = "                 from"
+		}
+		if index == len(err.IncludedFrom)-1 {
+			suffix = ":"
+		}
+		fmt.Fprintf(w, "%s %s%s\n", prefix, span.Start, suffix)
+	}
+	p.printHeader(w, err.Span.Start, severity, p.paint(bold, err.Message)+flagHint(err))
+	p.printSnippet(w, err.Span)
+
+	for _, note := range err.Notes {
+		fmt.Fprintf(w, "%s %s\n", p.paint(cyan, "note:"), note)
+	}
+	if err.Help != "" {
+		fmt.Fprintf(w, "%s %s\n", p.paint(bold, "help:"), err.Help)
+	}
+
+	for _, related := range err.Related {
+		p.printHeader(w, related.Span.Start, p.paint(cyan, "note:"), related.Message)
+		p.printSnippet(w, related.Span)
+	}
+}
+
+func (p *Printer) printHeader(w io.Writer, start token.Pos, label string, message string) {
+	if start.Line > 0 {
+		fmt.Fprint(w, p.paint(bold, start.String()+": "))
+	}
+	fmt.Fprintf(w, "%s %s\n", label, message)
+}
+
+// Prints the line that the span starts on, with the span underlined
+func (p *Printer) printSnippet(w io.Writer, span token.Span) {
+	source, ok := p.Sources[span.Start.File]
+	if !ok || span.Start.Line == 0 || span.Start.Offset > len(source) {
+		return
+	}
+
+	lineStart := strings.LastIndexByte(source[:span.Start.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[lineStart:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += lineStart
+	}
+	line := strings.TrimRight(source[lineStart:lineEnd], "\r")
+
+	// Spans which continue on to later lines are underlined until the end of the first line
+	startColumn := span.Start.Offset - lineStart
+	endColumn := span.End.Offset - lineStart
+	if span.End.Line != span.Start.Line || endColumn > len(line) {
+		endColumn = len(line)
+	}
+	if endColumn <= startColumn {
+		endColumn = startColumn + 1
+	}
+
+	// Preserve tabs so that the underline is aligned with the source line
+	var indent strings.Builder
+	for i := 0; i < startColumn && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	underline := "^" + strings.Repeat("~", endColumn-startColumn-1)
+
+	number := strconv.Itoa(span.Start.Line)
+	gutter := strings.Repeat(" ", len(number))
+	if len(number) < 4 {
+		number = strings.Repeat(" ", 4-len(number)) + number
+		gutter = "    "
+	}
+
+	fmt.Fprintf(w, "%s | %s\n", number, line)
+	fmt.Fprintf(w, "%s | %s%s\n", gutter, indent.String(), p.paint(green, underline))
+}
+
+// Names the command line flag which controls a warning, so that it can be easily disabled
+func flagHint(err *assembler.AssemblyError) string {
+	if !assembler.IsWarning(err.Rule) {
+		return ""
+	}
+
+	if err.Severity == assembler.ERROR {
+		return fmt.Sprintf(" [-Werror,-W%s]", err.Rule)
+	}
+	return fmt.Sprintf(" [-W%s]", err.Rule)
+}
+
+func (p *Printer) paint(color string, s string) string {
+	if !p.Color {
+		return s
+	}
+
+	return color + s + reset
+}
+
+// Reports whether the given file is an interactive terminal, in which case colour
+// output is appropriate
+func IsTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
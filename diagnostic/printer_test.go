@@ -0,0 +1,145 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alanfoster/assembler/assembler"
+	"github.com/stretchr/testify/assert"
+)
+
+func render(t *testing.T, source string, color bool) string {
+	_, err := assembler.New().ConvertFile("max.asm", source)
+	errs, ok := err.(assembler.ErrorList)
+	assert.True(t, ok)
+
+	var out bytes.Buffer
+	NewPrinter(map[string]string{"max.asm": source}, color).PrintAll(&out, errs)
+	return out.String()
+}
+
+func TestPrintWithSnippet(t *testing.T) {
+	source := "@R0\n  D=D+D\n"
+	expected := `max.asm:2:5: error: unknown computation "D+D"
+   2 |   D=D+D
+     |     ^~~
+note: valid computations using D are: !D, -D, A-D, D, D&A, D&M, D+1, D+A, D+M, D-1, D-A, D-M, D|A, D|M, M-D
+help: did you mean "D+1"?
+`
+
+	assert.Equal(t, expected, render(t, source, false))
+}
+
+func TestPrintPreservesTabs(t *testing.T) {
+	source := "\t@R0\n\tDM=M\n"
+	expected := "max.asm:2:2: error: unknown destination \"DM\"\n" +
+		"   2 | \tDM=M\n" +
+		"     | \t^~\n" +
+		"note: valid destinations are: A, AD, AM, AMD, D, M, MD\n" +
+		"help: did you mean \"MD\"?\n"
+
+	assert.Equal(t, expected, render(t, source, false))
+}
+
+func TestPrintMultipleErrors(t *testing.T) {
+	source := "@;\n(LOOP"
+	expected := `max.asm:1:2: error: expected a number or symbol, instead got: SEMICOLON ";"
+   1 | @;
+     |  ^
+max.asm:2:6: error: expected token type RIGHT_BRACKET, instead got: end of file
+   2 | (LOOP
+     |      ^
+`
+
+	assert.Equal(t, expected, render(t, source, false))
+}
+
+func TestPrintWithColor(t *testing.T) {
+	source := "0;JNZ"
+	expected := "\x1b[1mmax.asm:1:3: \x1b[0m\x1b[1;31merror:\x1b[0m \x1b[1munknown jump \"JNZ\"\x1b[0m\n" +
+		"   1 | 0;JNZ\n" +
+		"     |   \x1b[1;32m^~~\x1b[0m\n" +
+		"\x1b[1;36mnote:\x1b[0m valid jumps are: JEQ, JGE, JGT, JLE, JLT, JMP, JNE\n" +
+		"\x1b[1mhelp:\x1b[0m did you mean \"JNE\"?\n"
+
+	assert.Equal(t, expected, render(t, source, true))
+}
+
+func TestPrintWithoutSource(t *testing.T) {
+	errs := assembler.ErrorList{
+		&assembler.AssemblyError{Phase: assembler.ENCODE, Message: "unexpected instruction"},
+	}
+
+	var out bytes.Buffer
+	NewPrinter(nil, false).PrintAll(&out, errs)
+	assert.Equal(t, "error: unexpected instruction\n", out.String())
+}
+
+func TestPrintWarnings(t *testing.T) {
+	source := "(START)\n@0\n0;JMP"
+	a := assembler.New()
+	_, err := a.ConvertFile("max.asm", source)
+	assert.NoError(t, err)
+
+	expected := `max.asm:1:1: warning: label "START" is never used [-Wunused-label]
+   1 | (START)
+     | ^~~~~~~
+`
+
+	var out bytes.Buffer
+	NewPrinter(map[string]string{"max.asm": source}, false).PrintAll(&out, a.Warnings())
+	assert.Equal(t, expected, out.String())
+}
+
+func TestPrintWarningsAsErrors(t *testing.T) {
+	source := "(START)\n@0\n0;JMP"
+	a := assembler.New()
+	a.WarningsAsErrors = true
+	_, err := a.ConvertFile("max.asm", source)
+
+	expected := `max.asm:1:1: error: label "START" is never used [-Werror,-Wunused-label]
+   1 | (START)
+     | ^~~~~~~
+`
+
+	var out bytes.Buffer
+	NewPrinter(map[string]string{"max.asm": source}, false).PrintAll(&out, err.(assembler.ErrorList))
+	assert.Equal(t, expected, out.String())
+}
+
+func TestPrintRelatedLocations(t *testing.T) {
+	source := "(LOOP)\n@LOOP\n0;JMP\n(LOOP)\n"
+	expected := `max.asm:4:1: error: label "LOOP" is already defined
+   4 | (LOOP)
+     | ^~~~~~
+max.asm:1:1: note: label "LOOP" was first defined here
+   1 | (LOOP)
+     | ^~~~~~
+`
+
+	assert.Equal(t, expected, render(t, source, false))
+}
+
+func TestPrintIncludeChain(t *testing.T) {
+	a := assembler.New()
+	a.ReadFile = func(name string) ([]byte, error) {
+		files := map[string]string{"a.asm": "\n.include \"b.asm\"\n", "b.asm": "D=D+D\n"}
+		return []byte(files[name]), nil
+	}
+	_, err := a.ConvertFile("main.asm", ".include \"a.asm\"\n")
+	expected := `In file included from a.asm:2:1,
+                 from main.asm:1:1:
+b.asm:1:3: error: unknown computation "D+D"
+   1 | D=D+D
+     |   ^~~
+`
+
+	var out bytes.Buffer
+	printer := NewPrinter(a.Sources(), false)
+	for _, e := range err.(assembler.ErrorList) {
+		e.Notes = nil
+		e.Help = ""
+		printer.Print(&out, e)
+	}
+	assert.Equal(t, expected, out.String())
+}
@@ -0,0 +1,168 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alanfoster/assembler/assembler"
+	"github.com/alanfoster/assembler/token"
+)
+
+// The subset of the SARIF 2.1.0 format needed to report assembler diagnostics.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "hackassembler"
+	toolURI      = "https://github.com/AlanFoster/hackassembler"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Lines and columns start from 1, the end column is the column after the region
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// Writes the errors and warnings as a SARIF log, which allows code scanning tools to show
+// the diagnostics alongside the source
+func WriteSARIF(w io.Writer, errs assembler.ErrorList) error {
+	ruleIndexes := map[string]int{}
+	var rules []string
+	for _, err := range errs {
+		if _, ok := ruleIndexes[err.Rule]; !ok {
+			ruleIndexes[err.Rule] = 0
+			rules = append(rules, err.Rule)
+		}
+	}
+	sort.Strings(rules)
+
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{Name: toolName, InformationURI: toolURI, Rules: []sarifRule{}},
+		},
+		Results: []sarifResult{},
+	}
+	for index, rule := range rules {
+		ruleIndexes[rule] = index
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule})
+	}
+
+	for _, err := range errs {
+		result := sarifResult{
+			RuleID:    err.Rule,
+			RuleIndex: ruleIndexes[err.Rule],
+			Level:     err.Severity.String(),
+			Message:   sarifMessage{Text: sarifText(err)},
+		}
+
+		if err.Span.Start.Line > 0 {
+			result.Locations = []sarifLocation{{PhysicalLocation: newSARIFPhysicalLocation(err.Span)}}
+		}
+		for index, related := range err.Related {
+			id := index
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               &id,
+				PhysicalLocation: newSARIFPhysicalLocation(related.Span),
+				Message:          &sarifMessage{Text: related.Message},
+			})
+		}
+		for _, span := range err.IncludedFrom {
+			id := len(result.RelatedLocations)
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               &id,
+				PhysicalLocation: newSARIFPhysicalLocation(span),
+				Message:          &sarifMessage{Text: "included from here"},
+			})
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	log := sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func newSARIFPhysicalLocation(span token.Span) sarifPhysicalLocation {
+	return sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(span.Start.File)},
+		Region: sarifRegion{
+			StartLine:   span.Start.Line,
+			StartColumn: span.Start.Column,
+			EndLine:     span.End.Line,
+			EndColumn:   span.End.Column,
+		},
+	}
+}
+
+// SARIF viewers only show the message, so the notes and help are included within it
+func sarifText(err *assembler.AssemblyError) string {
+	lines := []string{err.Message}
+	for _, note := range err.Notes {
+		lines = append(lines, "note: "+note)
+	}
+	if err.Help != "" {
+		lines = append(lines, "help: "+err.Help)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	errs := assemble(t, "src/max.asm", "D=^M\n0;JNZ\n@;")
+	expected := `{
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "version": "2.1.0",
+  "runs": [
+    {
+      "tool": {
+        "driver": {
+          "name": "hackassembler",
+          "informationUri": "https://github.com/AlanFoster/hackassembler",
+          "rules": [
+            {
+              "id": "invalid-character"
+            },
+            {
+              "id": "unexpected-token"
+            },
+            {
+              "id": "unknown-jump"
+            }
+          ]
+        }
+      },
+      "results": [
+        {
+          "ruleId": "invalid-character",
+          "ruleIndex": 0,
+          "level": "error",
+          "message": {
+            "text": "unexpected character \"^\""
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "src/max.asm"
+                },
+                "region": {
+                  "startLine": 1,
+                  "startColumn": 3,
+                  "endLine": 1,
+                  "endColumn": 4
+                }
+              }
+            }
+          ]
+        },
+        {
+          "ruleId": "unknown-jump",
+          "ruleIndex": 2,
+          "level": "error",
+          "message": {
+            "text": "unknown jump \"JNZ\"\nnote: valid jumps are: JEQ, JGE, JGT, JLE, JLT, JMP, JNE\nhelp: did you mean \"JNE\"?"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "src/max.asm"
+                },
+                "region": {
+                  "startLine": 2,
+                  "startColumn": 3,
+                  "endLine": 2,
+                  "endColumn": 6
+                }
+              }
+            }
+          ]
+        },
+        {
+          "ruleId": "unexpected-token",
+          "ruleIndex": 1,
+          "level": "error",
+          "message": {
+            "text": "expected a number or symbol, instead got: SEMICOLON \";\""
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "src/max.asm"
+                },
+                "region": {
+                  "startLine": 3,
+                  "startColumn": 2,
+                  "endLine": 3,
+                  "endColumn": 3
+                }
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteSARIF(&out, errs))
+	assert.Equal(t, expected, out.String())
+}
+
+func TestWriteSARIFRelatedLocations(t *testing.T) {
+	errs := assemble(t, "max.asm", "(LOOP)\n@LOOP\n0;JMP\n(LOOP)\n")
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteSARIF(&out, errs))
+
+	var log sarifLog
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &log))
+	result := log.Runs[0].Results[0]
+	assert.Equal(t, "duplicate-label", result.RuleID)
+	assert.Equal(t, 4, result.Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Len(t, result.RelatedLocations, 1)
+	assert.Equal(t, 1, result.RelatedLocations[0].PhysicalLocation.Region.StartLine)
+	assert.Equal(t, `label "LOOP" was first defined here`, result.RelatedLocations[0].Message.Text)
+}
@@ -4,6 +4,20 @@ import (
 	"github.com/alanfoster/assembler/ast"
 	"fmt"
 	"github.com/alanfoster/assembler/symboltable"
+	"sort"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// The largest value an A-instruction can hold, as the remaining bit is its opcode
+const MaxValue = 1<<15 - 1
+
+// The range of values which can be loaded by a load instruction, such as D=#-1. Values
+// are 16 bits, which may be written as either signed or unsigned.
+const (
+	MinLoadValue = -1 << 15
+	MaxLoadValue = 1<<16 - 1
 )
 
 const nullDestCode = "000"
@@ -30,6 +44,15 @@ var jmpCodes = map[string]string{
 	"JMP": "111",
 }
 
+var inverseJumps = map[string]string{
+	"JGT": "JLE",
+	"JEQ": "JNE",
+	"JGE": "JLT",
+	"JLT": "JGE",
+	"JNE": "JEQ",
+	"JLE": "JGT",
+}
+
 var compCodes = map[string]string{
 	"0":   "0101010",
 	"1":   "0111111",
@@ -61,65 +84,256 @@ var compCodes = map[string]string{
 	"D|M": "1010101",
 }
 
+// Reports whether the given mnemonic is a valid destination, such as "AMD"
+func IsDest(dest string) bool {
+	_, ok := destCodes[dest]
+	return ok
+}
+
+// Reports whether the given mnemonic is a valid jump, such as "JGT"
+func IsJump(jump string) bool {
+	_, ok := jmpCodes[jump]
+	return ok
+}
+
+// The jump which is taken exactly when the given jump is not, such as JLE for JGT.
+// JMP is always taken, and so has no inverse.
+func InverseJump(jump string) (string, bool) {
+	inverse, ok := inverseJumps[jump]
+	return inverse, ok
+}
+
+// Reports whether the given mnemonic is a valid computation, such as "D+M"
+func IsComp(comp string) bool {
+	_, ok := compCodes[comp]
+	return ok
+}
+
+// All valid destination mnemonics, in sorted order
+func Dests() []string {
+	return keys(destCodes)
+}
+
+// All valid jump mnemonics, in sorted order
+func Jumps() []string {
+	return keys(jmpCodes)
+}
+
+// All valid computation mnemonics, in sorted order
+func Comps() []string {
+	return keys(compCodes)
+}
+
+func keys(codes map[string]string) []string {
+	var result []string
+	for key := range codes {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// Reported when a value can not be held by an A-instruction
+var ErrOutOfRange = errors.New("out of range")
+
+// Reported when a value refers to a symbol which is not within the symbol table
+var ErrUndefinedSymbol = errors.New("undefined symbol")
+
+// Evaluates the value of an A-instruction, resolving any symbols with the symbol table.
+// Intermediate results may fall outside the range of an A-instruction, only the final
+// value needs to fit, but each must fit within 64 bits rather than wrapping around.
+func Evaluate(value ast.AInstructionValue, st symboltable.SymbolTable) (int, error) {
+	result, err := evaluate(value, st)
+	if err != nil {
+		return 0, err
+	}
+	// Expressions are always evaluated in 64 bits, which int can not hold on 32-bit platforms
+	if int64(int(result)) != result {
+		return 0, fmt.Errorf("%v evaluates to %d, which overflows %d bits", value, result, bits.UintSize)
+	}
+
+	return int(result), nil
+}
+
+func evaluate(value ast.AInstructionValue, st symboltable.SymbolTable) (int64, error) {
+	switch value := value.(type) {
+	case *ast.Number:
+		return int64(value.Value), nil
+	case *ast.Variable:
+		if !st.Contains(value.Name) {
+			return 0, fmt.Errorf("%w %q", ErrUndefinedSymbol, value.Name)
+		}
+		return int64(st.Get(value.Name)), nil
+	case *ast.ParenExpression:
+		return evaluate(value.Expression, st)
+	case *ast.UnaryExpression:
+		operand, err := evaluate(value.Operand, st)
+		if err != nil {
+			return 0, err
+		}
+		if value.Operator != "-" {
+			return 0, fmt.Errorf("unknown operator %q", value.Operator)
+		}
+		if operand == math.MinInt64 {
+			return 0, fmt.Errorf("-(%d) overflows 64 bits", operand)
+		}
+		return -operand, nil
+	case *ast.BinaryExpression:
+		left, err := evaluate(value.Left, st)
+		if err != nil {
+			return 0, err
+		}
+		right, err := evaluate(value.Right, st)
+		if err != nil {
+			return 0, err
+		}
+		return apply(value.Operator, left, right)
+	}
+
+	return 0, fmt.Errorf("unexpected value %v", value)
+}
+
+func apply(operator string, left int64, right int64) (int64, error) {
+	overflow := fmt.Errorf("%d %s %d overflows 64 bits", left, operator, right)
+
+	switch operator {
+	case "+":
+		result := left + right
+		if (result > left) != (right > 0) {
+			return 0, overflow
+		}
+		return result, nil
+	case "-":
+		result := left - right
+		if (result < left) != (right > 0) {
+			return 0, overflow
+		}
+		return result, nil
+	case "*":
+		result := left * right
+		if left != 0 && (result/left != right || (left == -1 && right == math.MinInt64)) {
+			return 0, overflow
+		}
+		return result, nil
+	case "/":
+		if right == 0 {
+			return 0, errors.New("division by zero")
+		}
+		if left == math.MinInt64 && right == -1 {
+			return 0, overflow
+		}
+		return left / right, nil
+	case "&":
+		return left & right, nil
+	case "|":
+		return left | right, nil
+	case "<<", ">>":
+		if right < 0 {
+			return 0, fmt.Errorf("negative shift amount %d", right)
+		}
+		if right >= 63 {
+			return 0, fmt.Errorf("shift amount %d is too large, shifts must be less than 63", right)
+		}
+		if operator == "<<" {
+			result := left << uint(right)
+			if result>>uint(right) != left {
+				return 0, overflow
+			}
+			return result, nil
+		}
+		return left >> uint(right), nil
+	case "==":
+		return truth(left == right), nil
+	case "!=":
+		return truth(left != right), nil
+	case "<":
+		return truth(left < right), nil
+	case "<=":
+		return truth(left <= right), nil
+	case ">":
+		return truth(left > right), nil
+	case ">=":
+		return truth(left >= right), nil
+	}
+
+	return 0, fmt.Errorf("unknown operator %q", operator)
+}
+
+// Comparisons evaluate to 1 when they hold, and 0 otherwise
+func truth(condition bool) int64 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
 type Generator struct{}
 
 func New() *Generator {
 	return &Generator{}
 }
 
-func (g *Generator) ConvertAInstruction(instruction *ast.AInstruction, st symboltable.SymbolTable) string {
-	var number int
+func (g *Generator) ConvertAInstruction(instruction *ast.AInstruction, st symboltable.SymbolTable) (string, error) {
+	number, err := Evaluate(instruction.Value, st)
+	if err != nil {
+		return "", err
+	}
 
-	switch value := instruction.Value.(type) {
-	case *ast.Number:
-		number = value.Value
-	case *ast.Variable:
-		number = st[value.Name]
-	default:
-		panic(fmt.Errorf("unexpected value %v", value))
+	if number < 0 || number > MaxValue {
+		return "", fmt.Errorf("value %d is %w", number, ErrOutOfRange)
 	}
 
 	opCode := "0"
-	return fmt.Sprintf("%s%015b", opCode, number)
+	return fmt.Sprintf("%s%015b", opCode, number), nil
 }
 
-func (g *Generator) ConvertCInstruction(instruction *ast.CInstruction) string {
+func (g *Generator) ConvertCInstruction(instruction *ast.CInstruction) (string, error) {
 	opCode := "111"
-	compCode := g.compCode(instruction.Command)
-	destCode := g.destCode(instruction.Destination)
-	jmpCode := g.jmpCode(instruction.Jump)
+	compCode, err := g.compCode(instruction.Command)
+	if err != nil {
+		return "", err
+	}
+	destCode, err := g.destCode(instruction.Destination)
+	if err != nil {
+		return "", err
+	}
+	jmpCode, err := g.jmpCode(instruction.Jump)
+	if err != nil {
+		return "", err
+	}
 
-	return fmt.Sprintf("%s%s%s%s", opCode, compCode, destCode, jmpCode)
+	return fmt.Sprintf("%s%s%s%s", opCode, compCode, destCode, jmpCode), nil
 }
 
-func (g *Generator) compCode(command ast.Command) string {
+func (g *Generator) compCode(command ast.Command) (string, error) {
 	if value, ok := compCodes[command.Value]; ok {
-		return value
+		return value, nil
 	}
 
-	panic("command not found")
+	return "", fmt.Errorf("unknown computation %q", command.Value)
 }
 
-func (g *Generator) destCode(dest *ast.Value) string {
+func (g *Generator) destCode(dest *ast.Value) (string, error) {
 	if dest == nil {
-		return nullDestCode
+		return nullDestCode, nil
 	}
 
 	if value, ok := destCodes[dest.Value]; ok {
-		return value
+		return value, nil
 	}
 
-	panic("Unknown dest code")
+	return "", fmt.Errorf("unknown destination %q", dest.Value)
 }
 
-func (g *Generator) jmpCode(jmp *ast.Value) string {
+func (g *Generator) jmpCode(jmp *ast.Value) (string, error) {
 	if jmp == nil {
-		return nullJmpCode
+		return nullJmpCode, nil
 	}
 
 	if value, ok := jmpCodes[jmp.Value]; ok {
-		return value
+		return value, nil
 	}
 
-	panic("Unknown jmp code")
+	return "", fmt.Errorf("unknown jump %q", jmp.Value)
 }
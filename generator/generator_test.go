@@ -2,6 +2,8 @@ package generator
 
 import (
 	"testing"
+	"errors"
+	"math"
 	"github.com/stretchr/testify/assert"
 	"github.com/alanfoster/assembler/ast"
 	"github.com/alanfoster/assembler/symboltable"
@@ -13,7 +15,8 @@ func TestAInstructionWithZero(t *testing.T) {
 		Value: &ast.Number{Value: 0},
 	}
 	st := symboltable.New()
-	result := g.ConvertAInstruction(instruction, st)
+	result, err := g.ConvertAInstruction(instruction, st)
+	assert.NoError(t, err)
 	assert.Equal(t, "0000000000000000", result)
 }
 
@@ -23,7 +26,8 @@ func TestAInstructionWithThree(t *testing.T) {
 		Value: &ast.Number{Value: 3},
 	}
 	st := symboltable.New()
-	result := g.ConvertAInstruction(instruction, st)
+	result, err := g.ConvertAInstruction(instruction, st)
+	assert.NoError(t, err)
 	assert.Equal(t, "0000000000000011", result)
 }
 
@@ -33,7 +37,8 @@ func TestAInstructionWithMaximumNumber(t *testing.T) {
 		Value: &ast.Number{Value: 32767},
 	}
 	st := symboltable.New()
-	result := g.ConvertAInstruction(instruction, st)
+	result, err := g.ConvertAInstruction(instruction, st)
+	assert.NoError(t, err)
 	assert.Equal(t, "0111111111111111", result)
 }
 
@@ -43,7 +48,8 @@ func TestAInstructionWithVariablePointingToARegister(t *testing.T) {
 		Value: &ast.Variable{Name: "R15"},
 	}
 	st := symboltable.New()
-	result := g.ConvertAInstruction(instruction, st)
+	result, err := g.ConvertAInstruction(instruction, st)
+	assert.NoError(t, err)
 	assert.Equal(t, "0000000000001111", result)
 }
 
@@ -53,8 +59,9 @@ func TestAInstructionWithVariable(t *testing.T) {
 		Value: &ast.Variable{Name: "loop"},
 	}
 	st := symboltable.New()
-	st.Add("loop", 32767)
-	result := g.ConvertAInstruction(instruction, st)
+	st.Add("loop", symboltable.LABEL, 32767)
+	result, err := g.ConvertAInstruction(instruction, st)
+	assert.NoError(t, err)
 	assert.Equal(t, "0111111111111111", result)
 }
 
@@ -65,7 +72,8 @@ func TestCInstructionPrefixCommand(t *testing.T) {
 		Command:     ast.Command{Value: "!D"},
 		Jump:        nil,
 	}
-	result := g.ConvertCInstruction(instruction)
+	result, err := g.ConvertCInstruction(instruction)
+	assert.NoError(t, err)
 	assert.Equal(t, "1110001101000000", result)
 }
 
@@ -76,7 +84,8 @@ func TestCInstructionInfixCommand(t *testing.T) {
 		Command:     ast.Command{Value: "D+1"},
 		Jump:        nil,
 	}
-	result := g.ConvertCInstruction(instruction)
+	result, err := g.ConvertCInstruction(instruction)
+	assert.NoError(t, err)
 	assert.Equal(t, "1110011111000000", result)
 }
 
@@ -87,7 +96,8 @@ func TestCInstructionAssignment(t *testing.T) {
 		Command:     ast.Command{Value: "D+1"},
 		Jump:        nil,
 	}
-	result := g.ConvertCInstruction(instruction)
+	result, err := g.ConvertCInstruction(instruction)
+	assert.NoError(t, err)
 	assert.Equal(t, "1110011111100000", result)
 }
 
@@ -98,6 +108,174 @@ func TestCInstructionAlwaysJump(t *testing.T) {
 		Command:     ast.Command{Value: "0"},
 		Jump:        &ast.Value{Value: "JGT"},
 	}
-	result := g.ConvertCInstruction(instruction)
+	result, err := g.ConvertCInstruction(instruction)
+	assert.NoError(t, err)
 	assert.Equal(t, "1110101010000001", result)
 }
+
+func TestCInstructionUnknownCommand(t *testing.T) {
+	g := New()
+	instruction := &ast.CInstruction{
+		Destination: nil,
+		Command:     ast.Command{Value: "D*M"},
+		Jump:        nil,
+	}
+	_, err := g.ConvertCInstruction(instruction)
+	assert.EqualError(t, err, `unknown computation "D*M"`)
+}
+
+func TestCInstructionUnknownDestination(t *testing.T) {
+	g := New()
+	instruction := &ast.CInstruction{
+		Destination: &ast.Value{Value: "DA"},
+		Command:     ast.Command{Value: "D+1"},
+		Jump:        nil,
+	}
+	_, err := g.ConvertCInstruction(instruction)
+	assert.EqualError(t, err, `unknown destination "DA"`)
+}
+
+func TestCInstructionUnknownJump(t *testing.T) {
+	g := New()
+	instruction := &ast.CInstruction{
+		Destination: nil,
+		Command:     ast.Command{Value: "0"},
+		Jump:        &ast.Value{Value: "JNZ"},
+	}
+	_, err := g.ConvertCInstruction(instruction)
+	assert.EqualError(t, err, `unknown jump "JNZ"`)
+}
+
+func TestAInstructionWithVariableOutOfRange(t *testing.T) {
+	g := New()
+	instruction := &ast.AInstruction{
+		Value: &ast.Variable{Name: "loop"},
+	}
+	st := symboltable.New()
+	st.Add("loop", symboltable.LABEL, 32768)
+	_, err := g.ConvertAInstruction(instruction, st)
+	assert.EqualError(t, err, "value 32768 is out of range")
+}
+
+func TestAInstructionWithUndefinedSymbol(t *testing.T) {
+	g := New()
+	instruction := &ast.AInstruction{
+		Value: &ast.Variable{Name: "missing"},
+	}
+	st := symboltable.New()
+	_, err := g.ConvertAInstruction(instruction, st)
+	assert.EqualError(t, err, `undefined symbol "missing"`)
+}
+
+func TestEvaluate(t *testing.T) {
+	st := symboltable.New()
+	st.Add("TABLE", symboltable.LABEL, 100)
+	expression := &ast.BinaryExpression{
+		Operator: "-",
+		Left: &ast.BinaryExpression{
+			Operator: "*",
+			Left:     &ast.Variable{Name: "TABLE"},
+			Right:    &ast.Number{Value: 3},
+		},
+		Right: &ast.ParenExpression{
+			Expression: &ast.UnaryExpression{Operator: "-", Operand: &ast.Variable{Name: "R1"}},
+		},
+	}
+
+	result, err := Evaluate(expression, st)
+	assert.NoError(t, err)
+	assert.Equal(t, 301, result)
+}
+
+func TestEvaluateOperators(t *testing.T) {
+	tests := []struct {
+		operator string
+		expected int
+	}{
+		{"+", 14},
+		{"-", 10},
+		{"*", 24},
+		{"/", 6},
+		{"&", 0},
+		{"|", 14},
+		{"<<", 48},
+		{">>", 3},
+		{"==", 0},
+		{"!=", 1},
+		{"<", 0},
+		{"<=", 0},
+		{">", 1},
+		{">=", 1},
+	}
+
+	for _, test := range tests {
+		expression := &ast.BinaryExpression{Operator: test.operator, Left: &ast.Number{Value: 12}, Right: &ast.Number{Value: 2}}
+		result, err := Evaluate(expression, symboltable.New())
+		assert.NoError(t, err, test.operator)
+		assert.Equal(t, test.expected, result, test.operator)
+	}
+}
+
+func TestEvaluateDivisionByZero(t *testing.T) {
+	expression := &ast.BinaryExpression{Operator: "/", Left: &ast.Number{Value: 1}, Right: &ast.Number{Value: 0}}
+	_, err := Evaluate(expression, symboltable.New())
+	assert.EqualError(t, err, "division by zero")
+}
+
+func TestEvaluateOverflow(t *testing.T) {
+	tests := []struct {
+		operator string
+		left     int64
+		right    int64
+		expected string
+	}{
+		{"<<", 1, 64, "shift amount 64 is too large, shifts must be less than 63"},
+		{">>", 1, 63, "shift amount 63 is too large, shifts must be less than 63"},
+		{"<<", 3, 62, "3 << 62 overflows 64 bits"},
+		{"+", math.MaxInt64, 1, "9223372036854775807 + 1 overflows 64 bits"},
+		{"-", math.MinInt64, 1, "-9223372036854775808 - 1 overflows 64 bits"},
+		{"*", 1 << 32, 1 << 32, "4294967296 * 4294967296 overflows 64 bits"},
+		{"/", math.MinInt64, -1, "-9223372036854775808 / -1 overflows 64 bits"},
+	}
+
+	for _, test := range tests {
+		_, err := apply(test.operator, test.left, test.right)
+		assert.EqualError(t, err, test.expected, test.operator)
+	}
+
+	// The largest shift which fits is still allowed, even where int only holds 32 bits
+	expression := &ast.BinaryExpression{Operator: "<<", Left: &ast.Number{Value: 1}, Right: &ast.Number{Value: 62}}
+	result, err := evaluate(expression, symboltable.New())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<62), result)
+}
+
+func TestAInstructionWithExpressionOutOfRange(t *testing.T) {
+	g := New()
+	instruction := &ast.AInstruction{
+		Value: &ast.BinaryExpression{Operator: "-", Left: &ast.Variable{Name: "R1"}, Right: &ast.Number{Value: 2}},
+	}
+	_, err := g.ConvertAInstruction(instruction, symboltable.New())
+	assert.EqualError(t, err, "value -1 is out of range")
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+}
+
+func TestInverseJump(t *testing.T) {
+	// The bits of each jump are taken when the result is less than, equal to, or greater than 0
+	taken := func(jump string, sign int) bool {
+		return jmpCodes[jump][1+sign] == '1'
+	}
+
+	for _, jump := range Jumps() {
+		inverse, ok := InverseJump(jump)
+		if jump == "JMP" {
+			assert.False(t, ok)
+			continue
+		}
+
+		assert.True(t, ok, jump)
+		for _, sign := range []int{-1, 0, 1} {
+			assert.NotEqual(t, taken(jump, sign), taken(inverse, sign), "%s and %s for sign %d", jump, inverse, sign)
+		}
+	}
+}
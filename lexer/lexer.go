@@ -9,11 +9,23 @@ type Lexer struct {
 	index   int
 	current byte
 	source  string
+
+	// The position of the current character
+	file   string
+	line   int
+	column int
 }
 
 func New(source string) *Lexer {
+	return NewFile("", source)
+}
+
+// Creates a lexer whose token positions will refer to the given file name
+func NewFile(file string, source string) *Lexer {
 	l := &Lexer{
 		source: source,
+		file:   file,
+		line:   1,
 	}
 
 	l.next()
@@ -24,41 +36,77 @@ func (l *Lexer) Advance() token.Token {
 	var tok token.Token
 
 	l.skipCommentsAndWhitespace()
+	pos := l.pos()
 
 	switch l.current {
 	case '(':
-		tok = newCharToken(token.LEFT_BRACKET, l.current)
+		tok = newCharToken(token.LEFT_BRACKET, l.current, pos)
 	case ')':
-		tok = newCharToken(token.RIGHT_BRACKET, l.current)
+		tok = newCharToken(token.RIGHT_BRACKET, l.current, pos)
 	case '@':
-		tok = newCharToken(token.AT, l.current)
+		tok = newCharToken(token.AT, l.current, pos)
 	case ';':
-		tok = newCharToken(token.SEMICOLON, l.current)
+		tok = newCharToken(token.SEMICOLON, l.current, pos)
+	case ',':
+		tok = newCharToken(token.COMMA, l.current, pos)
+	case '#':
+		tok = newCharToken(token.HASH, l.current, pos)
+	case ':':
+		return newStringToken(token.VALUE, l.readAnonymousLabel(), pos)
 	case '=':
-		tok = newCharToken(token.EQUALS, l.current)
+		if l.peek() == '=' {
+			tok = newStringToken(token.OPERATOR, "==", pos)
+			l.next()
+		} else {
+			tok = newCharToken(token.EQUALS, l.current, pos)
+		}
 	case '|':
-		tok = newCharToken(token.OPERATOR, l.current)
+		tok = newCharToken(token.OPERATOR, l.current, pos)
 	case '&':
-		tok = newCharToken(token.OPERATOR, l.current)
+		tok = newCharToken(token.OPERATOR, l.current, pos)
 	case '+':
-		tok = newCharToken(token.OPERATOR, l.current)
+		tok = newCharToken(token.OPERATOR, l.current, pos)
 	case '-':
-		tok = newCharToken(token.OPERATOR, l.current)
+		tok = newCharToken(token.OPERATOR, l.current, pos)
 	case '!':
-		tok = newCharToken(token.OPERATOR, l.current)
+		if l.peek() == '=' {
+			tok = newStringToken(token.OPERATOR, "!=", pos)
+			l.next()
+		} else {
+			tok = newCharToken(token.OPERATOR, l.current, pos)
+		}
+	case '*':
+		tok = newCharToken(token.OPERATOR, l.current, pos)
+	case '/':
+		// Comments have already been skipped, so this is always division
+		tok = newCharToken(token.OPERATOR, l.current, pos)
+	case '<', '>':
+		// Shifts such as <<, comparisons such as <=, or a lone comparison
+		if l.peek() == l.current || l.peek() == '=' {
+			tok = newStringToken(token.OPERATOR, string([]byte{l.current, l.peek()}), pos)
+			l.next()
+		} else {
+			tok = newCharToken(token.OPERATOR, l.current, pos)
+		}
+	case '\n':
+		tok = newCharToken(token.NEWLINE, l.current, pos)
+	case '\'':
+		return newStringToken(token.CHARACTER, l.readQuoted('\''), pos)
+	case '"':
+		return newStringToken(token.STRING, l.readQuoted('"'), pos)
 	case 0:
-		tok = newStringToken(token.EOF, "")
+		tok = newStringToken(token.EOF, "", pos)
 	default:
 		if l.isDigit(l.current) {
 			value := l.readNumber()
-			return newStringToken(token.NUMBER, value)
+			return newStringToken(token.NUMBER, value, pos)
 		} else if l.isValue(l.current) {
 			value := l.readValue()
 			tokenType := token.MapValue(value)
 
-			return newStringToken(tokenType, value)
+			return newStringToken(tokenType, value, pos)
 		} else {
-			tok = newCharToken(token.INVALID, l.current)
+			tok = newCharToken(token.INVALID, l.current, pos)
 		}
 	}
 
@@ -66,15 +114,31 @@ func (l *Lexer) Advance() token.Token {
 	return tok
 }
 
-func newCharToken(tokenType token.Type, ch byte) token.Token {
-	return newStringToken(tokenType, string(ch))
+func newCharToken(tokenType token.Type, ch byte, pos token.Pos) token.Token {
+	return newStringToken(tokenType, string(ch), pos)
+}
+
+func newStringToken(tokenType token.Type, s string, pos token.Pos) token.Token {
+	return token.Token{Type: tokenType, Lexeme: s, Pos: pos}
 }
 
-func newStringToken(tokenType token.Type, s string) token.Token {
-	return token.Token{Type: tokenType, Lexeme: s}
+func (l *Lexer) pos() token.Pos {
+	return token.Pos{File: l.file, Line: l.line, Column: l.column, Offset: l.index - 1}
 }
 
 func (l *Lexer) next() {
+	// Remain on the end of the file, so that the position of EOF is stable
+	if l.index > len(l.source) {
+		return
+	}
+
+	if l.current == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.index >= len(l.source) {
 		l.current = 0 // Null byte
 	} else {
@@ -134,9 +198,24 @@ func (l *Lexer) readValue() string {
 	return buf.String()
 }
 
+// Reads a decimal number, or a hexadecimal or binary number with a 0x or 0b prefix. The
+// digits are validated by the parser, so that a helpful error can be reported.
 func (l *Lexer) readNumber() string {
 	var buf bytes.Buffer
 
+	if l.current == '0' && (l.peek() == 'x' || l.peek() == 'X' || l.peek() == 'b' || l.peek() == 'B') {
+		buf.WriteByte(l.current)
+		l.next()
+		buf.WriteByte(l.current)
+		l.next()
+
+		for l.isDigit(l.current) || l.isLetter(l.current) {
+			buf.WriteByte(l.current)
+			l.next()
+		}
+		return buf.String()
+	}
+
 	for l.isDigit(l.current) {
 		buf.WriteByte(l.current)
 		l.next()
@@ -145,6 +224,48 @@ func (l *Lexer) readNumber() string {
 	return buf.String()
 }
 
+// Reads a character literal or string including its quotes, such as 'A' or "math.asm".
+// Unterminated literals end at the end of the line, and are reported by the parser.
+func (l *Lexer) readQuoted(quote byte) string {
+	var buf bytes.Buffer
+
+	buf.WriteByte(l.current)
+	l.next()
+
+	for l.current != quote && l.current != '\n' && l.current != 0 {
+		if l.current == '\\' && l.peek() != '\n' && l.peek() != 0 {
+			buf.WriteByte(l.current)
+			l.next()
+		}
+		buf.WriteByte(l.current)
+		l.next()
+	}
+
+	if l.current == quote {
+		buf.WriteByte(l.current)
+		l.next()
+	}
+
+	return buf.String()
+}
+
+// Reads an anonymous label, ":", or a reference to one such as ":+" for the next
+// anonymous label, or ":--" for the second previous anonymous label
+func (l *Lexer) readAnonymousLabel() string {
+	var buf bytes.Buffer
+
+	buf.WriteByte(l.current)
+	l.next()
+
+	direction := l.current
+	for (direction == '+' || direction == '-') && l.current == direction {
+		buf.WriteByte(l.current)
+		l.next()
+	}
+
+	return buf.String()
+}
+
 func (l *Lexer) isValue(c byte) bool {
 	return l.isDigit(c) || l.isLetter(c) || c == '.' || c == '_' || c == '$'
 }
@@ -159,5 +280,6 @@ func (l *Lexer) isLetter(c byte) bool {
 }
 
 func (l *Lexer) isWhitespace(c byte) bool {
-	return c == ' ' || c == '\n' || c == '\r' || c == '\t'
+	// Newlines are significant, as they terminate each statement
+	return c == ' ' || c == '\r' || c == '\t'
 }
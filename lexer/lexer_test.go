@@ -10,16 +10,16 @@ func TestArbitraryCharTokens(t *testing.T) {
 	input := "()@;=|&+-!"
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.LEFT_BRACKET, Lexeme: "("},
-		{Type: token.RIGHT_BRACKET, Lexeme: ")"},
-		{Type: token.AT, Lexeme: "@"},
-		{Type: token.SEMICOLON, Lexeme: ";"},
-		{Type: token.EQUALS, Lexeme: "="},
-		{Type: token.OPERATOR, Lexeme: "|"},
-		{Type: token.OPERATOR, Lexeme: "&"},
-		{Type: token.OPERATOR, Lexeme: "+"},
-		{Type: token.OPERATOR, Lexeme: "-"},
-		{Type: token.OPERATOR, Lexeme: "!"},
+		{Type: token.LEFT_BRACKET, Lexeme: "(", Pos: pos(1, 1, 0)},
+		{Type: token.RIGHT_BRACKET, Lexeme: ")", Pos: pos(1, 2, 1)},
+		{Type: token.AT, Lexeme: "@", Pos: pos(1, 3, 2)},
+		{Type: token.SEMICOLON, Lexeme: ";", Pos: pos(1, 4, 3)},
+		{Type: token.EQUALS, Lexeme: "=", Pos: pos(1, 5, 4)},
+		{Type: token.OPERATOR, Lexeme: "|", Pos: pos(1, 6, 5)},
+		{Type: token.OPERATOR, Lexeme: "&", Pos: pos(1, 7, 6)},
+		{Type: token.OPERATOR, Lexeme: "+", Pos: pos(1, 8, 7)},
+		{Type: token.OPERATOR, Lexeme: "-", Pos: pos(1, 9, 8)},
+		{Type: token.OPERATOR, Lexeme: "!", Pos: pos(1, 10, 9)},
 	}
 
 	for _, expectedToken := range expected {
@@ -31,8 +31,8 @@ func TestValue(t *testing.T) {
 	input := "HELLOWORLD"
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.VALUE, Lexeme: "HELLOWORLD"},
-		{Type: token.EOF, Lexeme: ""},
+		{Type: token.VALUE, Lexeme: "HELLOWORLD", Pos: pos(1, 1, 0)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 11, 10)},
 	}
 
 	for _, expectedToken := range expected {
@@ -44,9 +44,9 @@ func TestValueThenChar(t *testing.T) {
 	input := "HELLOWORLD;"
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.VALUE, Lexeme: "HELLOWORLD"},
-		{Type: token.SEMICOLON, Lexeme: ";"},
-		{Type: token.EOF, Lexeme: ""},
+		{Type: token.VALUE, Lexeme: "HELLOWORLD", Pos: pos(1, 1, 0)},
+		{Type: token.SEMICOLON, Lexeme: ";", Pos: pos(1, 11, 10)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 12, 11)},
 	}
 
 	for _, expectedToken := range expected {
@@ -66,15 +66,23 @@ func TestJump(t *testing.T) {
 	`
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.JUMP, Lexeme: "JGT"},
-		{Type: token.JUMP, Lexeme: "JEQ"},
-		{Type: token.JUMP, Lexeme: "JGE"},
-		{Type: token.JUMP, Lexeme: "JLT"},
-		{Type: token.JUMP, Lexeme: "JNE"},
-		{Type: token.JUMP, Lexeme: "JLE"},
-		{Type: token.JUMP, Lexeme: "JMP"},
+		newline(1, 1, 0),
+		{Type: token.JUMP, Lexeme: "JGT", Pos: pos(2, 3, 3)},
+		newline(2, 6, 6),
+		{Type: token.JUMP, Lexeme: "JEQ", Pos: pos(3, 3, 9)},
+		newline(3, 6, 12),
+		{Type: token.JUMP, Lexeme: "JGE", Pos: pos(4, 3, 15)},
+		newline(4, 6, 18),
+		{Type: token.JUMP, Lexeme: "JLT", Pos: pos(5, 3, 21)},
+		newline(5, 6, 24),
+		{Type: token.JUMP, Lexeme: "JNE", Pos: pos(6, 3, 27)},
+		newline(6, 6, 30),
+		{Type: token.JUMP, Lexeme: "JLE", Pos: pos(7, 3, 33)},
+		newline(7, 6, 36),
+		{Type: token.JUMP, Lexeme: "JMP", Pos: pos(8, 3, 39)},
+		newline(8, 6, 42),
 
-		{Type: token.EOF, Lexeme: ""},
+		{Type: token.EOF, Lexeme: "", Pos: pos(9, 2, 44)},
 	}
 
 	for _, expectedToken := range expected {
@@ -86,11 +94,11 @@ func TestAInstruction(t *testing.T) {
 	input := "@1234 @Constant"
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.AT, Lexeme: "@"},
-		{Type: token.NUMBER, Lexeme: "1234"},
-		{Type: token.AT, Lexeme: "@"},
-		{Type: token.VALUE, Lexeme: "Constant"},
-		{Type: token.EOF, Lexeme: ""},
+		{Type: token.AT, Lexeme: "@", Pos: pos(1, 1, 0)},
+		{Type: token.NUMBER, Lexeme: "1234", Pos: pos(1, 2, 1)},
+		{Type: token.AT, Lexeme: "@", Pos: pos(1, 7, 6)},
+		{Type: token.VALUE, Lexeme: "Constant", Pos: pos(1, 8, 7)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 16, 15)},
 	}
 
 	for _, expectedToken := range expected {
@@ -102,13 +110,13 @@ func TestCInstruction(t *testing.T) {
 	input := "A=D+1;JGT"
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.VALUE, Lexeme: "A"},
-		{Type: token.EQUALS, Lexeme: "="},
-		{Type: token.VALUE, Lexeme: "D"},
-		{Type: token.OPERATOR, Lexeme: "+"},
-		{Type: token.NUMBER, Lexeme: "1"},
-		{Type: token.SEMICOLON, Lexeme: ";"},
-		{Type: token.JUMP, Lexeme: "JGT"},
+		{Type: token.VALUE, Lexeme: "A", Pos: pos(1, 1, 0)},
+		{Type: token.EQUALS, Lexeme: "=", Pos: pos(1, 2, 1)},
+		{Type: token.VALUE, Lexeme: "D", Pos: pos(1, 3, 2)},
+		{Type: token.OPERATOR, Lexeme: "+", Pos: pos(1, 4, 3)},
+		{Type: token.NUMBER, Lexeme: "1", Pos: pos(1, 5, 4)},
+		{Type: token.SEMICOLON, Lexeme: ";", Pos: pos(1, 6, 5)},
+		{Type: token.JUMP, Lexeme: "JGT", Pos: pos(1, 7, 6)},
 	}
 
 	for _, expectedToken := range expected {
@@ -124,15 +132,19 @@ func TestCInstructionWithWhitespaceAndComments(t *testing.T) {
 		/`
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.VALUE, Lexeme: "A"},
-		{Type: token.EQUALS, Lexeme: "="},
-		{Type: token.VALUE, Lexeme: "D"},
-		{Type: token.OPERATOR, Lexeme: "+"},
-		{Type: token.NUMBER, Lexeme: "1"},
-		{Type: token.SEMICOLON, Lexeme: ";"},
-		{Type: token.JUMP, Lexeme: "JGT"},
-		{Type: token.INVALID, Lexeme: "/"},
-		{Type: token.EOF, Lexeme: ""},
+		newline(1, 1, 0),
+		newline(2, 25, 25),
+		{Type: token.VALUE, Lexeme: "A", Pos: pos(3, 3, 28)},
+		{Type: token.EQUALS, Lexeme: "=", Pos: pos(3, 4, 29)},
+		{Type: token.VALUE, Lexeme: "D", Pos: pos(3, 5, 30)},
+		{Type: token.OPERATOR, Lexeme: "+", Pos: pos(3, 6, 31)},
+		{Type: token.NUMBER, Lexeme: "1", Pos: pos(3, 7, 32)},
+		{Type: token.SEMICOLON, Lexeme: ";", Pos: pos(3, 8, 33)},
+		{Type: token.JUMP, Lexeme: "JGT", Pos: pos(3, 9, 34)},
+		newline(3, 30, 55),
+		newline(4, 23, 78),
+		{Type: token.OPERATOR, Lexeme: "/", Pos: pos(5, 3, 81)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(5, 4, 82)},
 	}
 
 	for _, expectedToken := range expected {
@@ -146,10 +158,166 @@ func TestLabel(t *testing.T) {
 	`
 	l := New(input)
 	expected := []token.Token{
-		{Type: token.LEFT_BRACKET, Lexeme: "("},
-		{Type: token.VALUE, Lexeme: "$LABEL.FOO.BAR.BAZ"},
-		{Type: token.RIGHT_BRACKET, Lexeme: ")"},
-		{Type: token.EOF, Lexeme: ""},
+		newline(1, 1, 0),
+		{Type: token.LEFT_BRACKET, Lexeme: "(", Pos: pos(2, 3, 3)},
+		{Type: token.VALUE, Lexeme: "$LABEL.FOO.BAR.BAZ", Pos: pos(2, 4, 4)},
+		{Type: token.RIGHT_BRACKET, Lexeme: ")", Pos: pos(2, 22, 22)},
+		newline(2, 23, 23),
+		{Type: token.EOF, Lexeme: "", Pos: pos(3, 2, 25)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func pos(line int, column int, offset int) token.Pos {
+	return token.Pos{Line: line, Column: column, Offset: offset}
+}
+
+func newline(line int, column int, offset int) token.Token {
+	return token.Token{Type: token.NEWLINE, Lexeme: "\n", Pos: pos(line, column, offset)}
+}
+
+func TestPositionsIncludeFileName(t *testing.T) {
+	input := "@1\r\n\tD=A"
+	l := NewFile("add.asm", input)
+	expected := []token.Token{
+		{Type: token.AT, Lexeme: "@", Pos: token.Pos{File: "add.asm", Line: 1, Column: 1, Offset: 0}},
+		{Type: token.NUMBER, Lexeme: "1", Pos: token.Pos{File: "add.asm", Line: 1, Column: 2, Offset: 1}},
+		{Type: token.NEWLINE, Lexeme: "\n", Pos: token.Pos{File: "add.asm", Line: 1, Column: 4, Offset: 3}},
+		{Type: token.VALUE, Lexeme: "D", Pos: token.Pos{File: "add.asm", Line: 2, Column: 2, Offset: 5}},
+		{Type: token.EQUALS, Lexeme: "=", Pos: token.Pos{File: "add.asm", Line: 2, Column: 3, Offset: 6}},
+		{Type: token.VALUE, Lexeme: "A", Pos: token.Pos{File: "add.asm", Line: 2, Column: 4, Offset: 7}},
+		{Type: token.EOF, Lexeme: "", Pos: token.Pos{File: "add.asm", Line: 2, Column: 5, Offset: 8}},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := "0x4000 0B1010 0xZZ 42"
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.NUMBER, Lexeme: "0x4000", Pos: pos(1, 1, 0)},
+		{Type: token.NUMBER, Lexeme: "0B1010", Pos: pos(1, 8, 7)},
+		{Type: token.NUMBER, Lexeme: "0xZZ", Pos: pos(1, 15, 14)},
+		{Type: token.NUMBER, Lexeme: "42", Pos: pos(1, 20, 19)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 22, 21)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestCharacterLiterals(t *testing.T) {
+	input := `'A' '\'' ' ' 'unterminated
+'`
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.CHARACTER, Lexeme: `'A'`, Pos: pos(1, 1, 0)},
+		{Type: token.CHARACTER, Lexeme: `'\''`, Pos: pos(1, 5, 4)},
+		{Type: token.CHARACTER, Lexeme: `' '`, Pos: pos(1, 10, 9)},
+		{Type: token.CHARACTER, Lexeme: `'unterminated`, Pos: pos(1, 14, 13)},
+		newline(1, 27, 26),
+		{Type: token.CHARACTER, Lexeme: `'`, Pos: pos(2, 1, 27)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(2, 2, 28)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestExpressionOperators(t *testing.T) {
+	input := "*/<<>>< ><=>===!=!"
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.OPERATOR, Lexeme: "*", Pos: pos(1, 1, 0)},
+		{Type: token.OPERATOR, Lexeme: "/", Pos: pos(1, 2, 1)},
+		{Type: token.OPERATOR, Lexeme: "<<", Pos: pos(1, 3, 2)},
+		{Type: token.OPERATOR, Lexeme: ">>", Pos: pos(1, 5, 4)},
+		{Type: token.OPERATOR, Lexeme: "<", Pos: pos(1, 7, 6)},
+		{Type: token.OPERATOR, Lexeme: ">", Pos: pos(1, 9, 8)},
+		{Type: token.OPERATOR, Lexeme: "<=", Pos: pos(1, 10, 9)},
+		{Type: token.OPERATOR, Lexeme: ">=", Pos: pos(1, 12, 11)},
+		{Type: token.OPERATOR, Lexeme: "==", Pos: pos(1, 14, 13)},
+		{Type: token.OPERATOR, Lexeme: "!=", Pos: pos(1, 16, 15)},
+		{Type: token.OPERATOR, Lexeme: "!", Pos: pos(1, 18, 17)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 19, 18)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `.include "lib/a b.asm" "\"" "unterminated`
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.VALUE, Lexeme: ".include", Pos: pos(1, 1, 0)},
+		{Type: token.STRING, Lexeme: `"lib/a b.asm"`, Pos: pos(1, 10, 9)},
+		{Type: token.STRING, Lexeme: `"\""`, Pos: pos(1, 24, 23)},
+		{Type: token.STRING, Lexeme: `"unterminated`, Pos: pos(1, 29, 28)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 42, 41)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestCommas(t *testing.T) {
+	input := "PUSH 1, X"
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.VALUE, Lexeme: "PUSH", Pos: pos(1, 1, 0)},
+		{Type: token.NUMBER, Lexeme: "1", Pos: pos(1, 6, 5)},
+		{Type: token.COMMA, Lexeme: ",", Pos: pos(1, 7, 6)},
+		{Type: token.VALUE, Lexeme: "X", Pos: pos(1, 9, 8)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 10, 9)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestAnonymousLabels(t *testing.T) {
+	input := "(:) @:+ @:-- :+-"
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.LEFT_BRACKET, Lexeme: "(", Pos: pos(1, 1, 0)},
+		{Type: token.VALUE, Lexeme: ":", Pos: pos(1, 2, 1)},
+		{Type: token.RIGHT_BRACKET, Lexeme: ")", Pos: pos(1, 3, 2)},
+		{Type: token.AT, Lexeme: "@", Pos: pos(1, 5, 4)},
+		{Type: token.VALUE, Lexeme: ":+", Pos: pos(1, 6, 5)},
+		{Type: token.AT, Lexeme: "@", Pos: pos(1, 9, 8)},
+		{Type: token.VALUE, Lexeme: ":--", Pos: pos(1, 10, 9)},
+		{Type: token.VALUE, Lexeme: ":+", Pos: pos(1, 14, 13)},
+		{Type: token.OPERATOR, Lexeme: "-", Pos: pos(1, 16, 15)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 17, 16)},
+	}
+
+	for _, expectedToken := range expected {
+		assert.Equal(t, expectedToken, l.Advance())
+	}
+}
+
+func TestLoadInstruction(t *testing.T) {
+	input := "D=#-1"
+	l := New(input)
+	expected := []token.Token{
+		{Type: token.VALUE, Lexeme: "D", Pos: pos(1, 1, 0)},
+		{Type: token.EQUALS, Lexeme: "=", Pos: pos(1, 2, 1)},
+		{Type: token.HASH, Lexeme: "#", Pos: pos(1, 3, 2)},
+		{Type: token.OPERATOR, Lexeme: "-", Pos: pos(1, 4, 3)},
+		{Type: token.NUMBER, Lexeme: "1", Pos: pos(1, 5, 4)},
+		{Type: token.EOF, Lexeme: "", Pos: pos(1, 6, 5)},
 	}
 
 	for _, expectedToken := range expected {
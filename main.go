@@ -1,30 +1,219 @@
 package main
 
 import (
-	"github.com/alanfoster/assembler/assembler"
 	"flag"
-	"io/ioutil"
 	"fmt"
+	"github.com/alanfoster/assembler/assembler"
+	"github.com/alanfoster/assembler/diagnostic"
+	"github.com/alanfoster/assembler/parser"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
 )
 
-func assemble(entryFile string, outputFile string) {
-	data, err := ioutil.ReadFile(entryFile)
+type options struct {
+	entryFile   string
+	outputFile  string
+	listingFile string
+	maxErrors   int
+	color       string
+	format      string
+	// Warnings explicitly enabled or disabled on the command line
+	warnings map[string]bool
+	werror   bool
+
+	variableCeiling int
+	stats           bool
+	strict          bool
+	// Constants defined with -D NAME=value
+	constants map[string]int
+	// Directories searched for included files, from -I
+	includePaths includeFlag
+}
+
+// A boolean flag such as -Wunused-label or -Wno-unused-label, which enables or disables a warning
+type warningFlag struct {
+	warnings map[string]bool
+	id       string
+	enable   bool
+}
+
+func (f warningFlag) String() string {
+	return ""
+}
+
+func (f warningFlag) Set(value string) error {
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if set {
+		f.warnings[f.id] = f.enable
+	}
+	return nil
+}
+
+func (f warningFlag) IsBoolFlag() bool {
+	return true
+}
+
+// A repeatable flag such as -D WIDTH=512, which defines a constant. The value defaults to 1.
+type defineFlag map[string]int
+
+func (f defineFlag) String() string {
+	return ""
+}
+
+func (f defineFlag) Set(definition string) error {
+	name, value, hasValue := strings.Cut(definition, "=")
+	if name == "" {
+		return fmt.Errorf("expected NAME=value, instead got %q", definition)
+	}
+	if !hasValue {
+		f[name] = 1
+		return nil
+	}
+
+	number, err := parser.ParseInteger(value)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for constant %s", value, name)
+	}
+	f[name] = int(number)
+	return nil
+}
+
+// A repeatable flag such as -I lib, which adds a directory to search for included files
+type includeFlag []string
+
+func (f *includeFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *includeFlag) Set(dir string) error {
+	*f = append(*f, dir)
+	return nil
+}
+
+func assemble(opts options) error {
+	data, err := ioutil.ReadFile(opts.entryFile)
 	if err != nil {
-		fmt.Println("Ruh roh")
-		panic(err)
+		return err
 	}
 	source := string(data)
-	result := assembler.New().Convert(source)
 
-	ioutil.WriteFile(outputFile, []byte(result), 0644)
+	a := assembler.New()
+	a.MaxErrors = opts.maxErrors
+	a.WarningsAsErrors = opts.werror
+	a.VariableCeiling = opts.variableCeiling
+	a.Strict = opts.strict
+	a.Constants = opts.constants
+	a.IncludePaths = opts.includePaths
+	for id, enabled := range opts.warnings {
+		a.EnabledWarnings[id] = enabled
+	}
+
+	result, err := a.ConvertFile(opts.entryFile, source)
+	errs, ok := err.(assembler.ErrorList)
+	if err != nil && !ok {
+		return err
+	}
+
+	diagnostics := append(a.Warnings(), errs...)
+	if err := reportDiagnostics(opts, a.Sources(), diagnostics); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s generated", count(len(errs), "error", "errors"))
+	}
+
+	if opts.stats {
+		stats := a.Stats()
+		fmt.Fprintf(os.Stderr, "%s, %s\n", count(stats.Instructions, "instruction", "instructions"), count(stats.Variables, "variable", "variables"))
+	}
+
+	if opts.listingFile != "" {
+		if err := writeListing(opts.listingFile, a.Listing()); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(opts.outputFile, []byte(result), 0644)
+}
+
+// Formats a number along with the noun it counts, such as "1 error" or "2 errors"
+func count(n int, singular string, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+func writeListing(file string, listing []assembler.ListingEntry) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := assembler.WriteListing(f, listing); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Machine readable formats are always written to stdout, so that a report is available
+// even when there are no errors. Text diagnostics are written to stderr.
+func reportDiagnostics(opts options, sources map[string]string, diagnostics assembler.ErrorList) error {
+	switch opts.format {
+	case "json":
+		return diagnostic.WriteJSON(os.Stdout, diagnostics)
+	case "sarif":
+		return diagnostic.WriteSARIF(os.Stdout, diagnostics)
+	case "text":
+		printer := diagnostic.NewPrinter(sources, useColor(opts.color))
+		printer.PrintAll(os.Stderr, diagnostics)
+		return nil
+	}
+
+	return fmt.Errorf("unknown diagnostics format %q, expected text, json or sarif", opts.format)
+}
+
+// Diagnostics are written to stderr, so colour is only used by default when stderr is a terminal
+func useColor(color string) bool {
+	switch color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	return diagnostic.IsTerminal(os.Stderr) && os.Getenv("NO_COLOR") == ""
 }
 
 func main() {
-	var entryFile string
-	var outputFile string
-	flag.StringVar(&entryFile, "entry-file", "", "File to convert to hack")
-	flag.StringVar(&outputFile, "output-file", "", "File to save the output to")
+	opts := options{warnings: map[string]bool{}, constants: map[string]int{}}
+	flag.StringVar(&opts.entryFile, "entry-file", "", "File to convert to hack")
+	flag.StringVar(&opts.outputFile, "output-file", "", "File to save the output to")
+	flag.StringVar(&opts.listingFile, "listing-file", "", "File to save a listing of each instruction's address and binary to")
+	flag.IntVar(&opts.maxErrors, "max-errors", parser.DefaultMaxErrors, "Number of errors to report before stopping, 0 reports all errors")
+	flag.StringVar(&opts.color, "color", "auto", "Whether to colour diagnostics: auto, always or never")
+	flag.StringVar(&opts.format, "diagnostics-format", "text", "Format of reported diagnostics: text, json or sarif")
+	flag.IntVar(&opts.variableCeiling, "variable-ceiling", 0, "Exclusive upper bound for variable addresses, defaults to the start of the screen")
+	flag.Var(defineFlag(opts.constants), "D", "Define a constant as NAME=value, which can be repeated")
+	flag.Var(&opts.includePaths, "I", "Add a directory to search for included files, which can be repeated")
+	flag.BoolVar(&opts.strict, "strict", false, "Require every variable to be declared with .var")
+	flag.BoolVar(&opts.stats, "stats", false, "Report the number of instructions and variables allocated")
+	flag.BoolVar(&opts.werror, "Werror", false, "Report warnings as errors")
+	for _, warning := range assembler.KnownWarnings {
+		flag.Var(warningFlag{opts.warnings, warning.ID, true}, "W"+warning.ID, "Warn when "+warning.Description)
+		flag.Var(warningFlag{opts.warnings, warning.ID, false}, "Wno-"+warning.ID, "Disable -W"+warning.ID)
+	}
 	flag.Parse()
 
-	assemble(entryFile, outputFile)
+	if err := assemble(opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
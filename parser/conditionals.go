@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/token"
+)
+
+// Conditional ->
+//
+//	(".if" Expression | (".ifdef" | ".ifndef") Value) Newline Statement*
+//	(".elif" Expression Newline Statement*)*
+//	(".else" Newline Statement*)?
+//	".endif"
+//
+// When the condition of an .if is a RuntimeCondition, such as D>0, each branch must also
+// be a RuntimeCondition and the result is an IfStatement which is checked when the
+// program runs.
+func (p *Parser) parseConditional() ast.Instruction {
+	opening := p.current
+	p.nextToken()
+	runtime := opening.Lexeme == ".if" && p.isRuntimeCondition()
+	conditional := &ast.ConditionalDirective{}
+	valid := true
+
+	directive := opening
+	for {
+		branch, ok := p.parseBranchHeader(directive, runtime)
+		valid = valid && ok
+		if conditional.Span.Start.Line == 0 {
+			conditional.Span = branch.Span
+		}
+
+		body, end, ok := p.parseBlock(opening, conditional.Span, ".elif", ".else", ".endif")
+		if !ok {
+			return nil
+		}
+		if branch.Directive == ".else" && end.Lexeme != ".endif" {
+			p.report(&Error{
+				Rule:    UnmatchedDirective,
+				Token:   end,
+				Span:    end.Span(),
+				Message: fmt.Sprintf("%s after .else", end.Lexeme),
+				Help:    ".else must be the last branch of a conditional",
+			})
+			valid = false
+		}
+		branch.Body = body
+		branch.Region = token.Span{Start: branch.Span.Start, End: end.Pos}
+		conditional.Branches = append(conditional.Branches, branch)
+
+		if end.Lexeme == ".endif" {
+			break
+		}
+		directive = end
+	}
+
+	if !valid {
+		return nil
+	}
+	if runtime {
+		return &ast.IfStatement{Branches: conditional.Branches, Span: conditional.Span}
+	}
+	return conditional
+}
+
+// Parses the condition of a branch, after the directive which starts it. The branch is
+// returned even when invalid, so that its body is still parsed.
+func (p *Parser) parseBranchHeader(directive token.Token, runtime bool) (*ast.ConditionalBranch, bool) {
+	branch := &ast.ConditionalBranch{Directive: directive.Lexeme}
+
+	switch directive.Lexeme {
+	case ".ifdef", ".ifndef":
+		name := p.current
+		if p.advance(token.VALUE) {
+			branch.Condition = &ast.Variable{Name: name.Lexeme, Span: name.Span()}
+		}
+	case ".if", ".elif":
+		if runtime != p.isRuntimeCondition() {
+			p.mixedConditional(directive, runtime)
+		} else if runtime {
+			if condition := p.parseRuntimeCondition(); condition != nil {
+				branch.Condition = condition
+			}
+		} else {
+			branch.Condition = p.parseExpression()
+		}
+	}
+	branch.Span = p.spanFrom(directive.Pos)
+
+	ok := branch.Condition != nil || directive.Lexeme == ".else"
+	if ok && !p.isEndOfStatement() {
+		p.trailingTokens()
+		ok = false
+	}
+	if !ok {
+		p.synchronize()
+	}
+
+	return branch, ok
+}
+
+// ErrorDirective -> ".error" String
+func (p *Parser) parseErrorDirective() ast.Instruction {
+	start := p.current.Pos
+	p.advance(token.VALUE)
+
+	message := p.parseString()
+	if message == nil {
+		return nil
+	}
+
+	return &ast.ErrorDirective{Message: *message, Span: p.spanFrom(start)}
+}
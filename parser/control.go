@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/generator"
+	"github.com/alanfoster/assembler/token"
+)
+
+// The operators which compare a computation with 0 within a runtime condition
+var comparisons = map[string]bool{
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"==": true,
+	"!=": true,
+}
+
+// Conditions which start with a register, such as D>0 or -D<=0, are checked when the
+// program runs. All other conditions are evaluated when assembling.
+func (p *Parser) isRuntimeCondition() bool {
+	isRegister := func(tok token.Token) bool {
+		return tok.Type == token.VALUE && IsRegisters(tok.Lexeme)
+	}
+
+	if p.isCurrent(token.OPERATOR) && (p.current.Lexeme == "!" || p.current.Lexeme == "-") {
+		return isRegister(p.peek)
+	}
+	return isRegister(p.current)
+}
+
+// RuntimeCondition -> Computation ("<" | "<=" | ">" | ">=" | "==" | "!=") "0"
+func (p *Parser) parseRuntimeCondition() *ast.RuntimeCondition {
+	start := p.current.Pos
+	if p.isEndOfStatement() {
+		p.unexpected(p.current, fmt.Sprintf("expected a runtime condition such as D>0, instead got: %s", describe(p.current)))
+		return nil
+	}
+
+	var computation strings.Builder
+	for !p.isEndOfStatement() && !(p.isCurrent(token.OPERATOR) && comparisons[p.current.Lexeme]) {
+		computation.WriteString(p.current.Lexeme)
+		p.nextToken()
+	}
+	command := ast.Command{Value: computation.String(), Span: p.spanFrom(start)}
+
+	if !generator.IsComp(command.Value) {
+		p.report(&Error{
+			Rule:    UnknownComp,
+			Token:   p.previous,
+			Span:    command.Span,
+			Message: fmt.Sprintf("unknown computation %q", command.Value),
+			Help:    didYouMean(suggestComp(command.Value)),
+			Notes:   []string{compNote(command.Value)},
+		})
+		return nil
+	}
+	if strings.ContainsAny(command.Value, "AM") {
+		p.report(&Error{
+			Rule:    InvalidRuntimeCondition,
+			Token:   p.previous,
+			Span:    command.Span,
+			Message: fmt.Sprintf("runtime condition %q can only use D, as jumping to a label changes A", command.Value),
+			Help:    "load the value into D first, such as D=M",
+		})
+		return nil
+	}
+
+	operator := p.current
+	if !p.isCurrent(token.OPERATOR) {
+		p.unexpected(p.current, fmt.Sprintf("expected a comparison such as %s>0, instead got: %s", command.Value, describe(p.current)))
+		return nil
+	}
+	p.nextToken()
+
+	zero := p.current
+	if !p.isCurrent(token.NUMBER) || zero.Lexeme != "0" {
+		p.report(&Error{
+			Rule:    InvalidRuntimeCondition,
+			Token:   zero,
+			Span:    zero.Span(),
+			Message: fmt.Sprintf("runtime conditions compare with 0, instead got: %s", describe(zero)),
+			Help:    fmt.Sprintf("compute the difference into D first, such as D=D-A, and then check D%s0", operator.Lexeme),
+		})
+		return nil
+	}
+	p.nextToken()
+
+	return &ast.RuntimeCondition{Computation: command, Operator: operator.Lexeme, Span: p.spanFrom(start)}
+}
+
+// The branches of a conditional are either all checked when the program runs, or all evaluated when assembling
+func (p *Parser) mixedConditional(directive token.Token, runtime bool) {
+	message := fmt.Sprintf("expected a runtime condition such as D>0, instead got: %s", describe(p.current))
+	if !runtime {
+		message = "runtime condition within a conditional which is evaluated when assembling"
+	}
+
+	p.report(&Error{
+		Rule:    MixedConditional,
+		Token:   p.current,
+		Span:    p.current.Span(),
+		Message: message,
+		Help:    fmt.Sprintf("the conditions of %s must all be checked when the program runs, or all be evaluated when assembling", directive.Lexeme),
+	})
+}
+
+// WhileStatement -> ".while" RuntimeCondition Newline Statement* ".endwhile"
+func (p *Parser) parseWhileStatement() ast.Instruction {
+	opening := p.current
+	p.advance(token.VALUE)
+
+	statement := &ast.WhileStatement{Condition: p.parseRuntimeCondition()}
+	statement.Span = p.spanFrom(opening.Pos)
+
+	body, closing, ok := p.parseControlBody(opening, statement.Span, statement.Condition != nil, ".endwhile")
+	if !ok {
+		return nil
+	}
+
+	statement.Body = body
+	statement.Closing = closing.Span()
+	return statement
+}
+
+// LoopStatement -> ".loop" Expression Newline Statement* ".endloop"
+func (p *Parser) parseLoopStatement() ast.Instruction {
+	opening := p.current
+	p.advance(token.VALUE)
+
+	statement := &ast.LoopStatement{Count: p.parseExpression()}
+	statement.Span = p.spanFrom(opening.Pos)
+
+	body, closing, ok := p.parseControlBody(opening, statement.Span, statement.Count != nil, ".endloop")
+	if !ok {
+		return nil
+	}
+
+	statement.Body = body
+	statement.Closing = closing.Span()
+	return statement
+}
+
+// Parses the body of a runtime statement up until the directive which closes it. The body
+// is parsed even when the header is invalid, so that its closing directive is not reported
+// as unmatched.
+func (p *Parser) parseControlBody(opening token.Token, header token.Span, valid bool, end string) ([]ast.Instruction, token.Token, bool) {
+	if valid && !p.isEndOfStatement() {
+		p.trailingTokens()
+		valid = false
+	}
+	if !valid {
+		p.synchronize()
+	}
+
+	body, closing, ok := p.parseBlock(opening, header, end)
+	return body, closing, ok && valid
+}
@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/suggest"
+	"github.com/alanfoster/assembler/token"
+)
+
+// Directives are instructions to the assembler, rather than instructions for the CPU,
+// and start with a '.' such as ".var counter"
+var directives map[string]func(p *Parser) ast.Instruction
+
+// Registered on initialisation, as directives which contain a block of statements
+// parse further directives within it
+func init() {
+	directives = map[string]func(p *Parser) ast.Instruction{
+		".var":      (*Parser).parseVarDirective,
+		".equ":      (*Parser).parseConstantDirective,
+		".define":   (*Parser).parseConstantDirective,
+		".alias":    (*Parser).parseAliasDirective,
+		".module":   (*Parser).parseModuleDirective,
+		".include":  (*Parser).parseIncludeDirective,
+		".macro":    (*Parser).parseMacroDefinition,
+		".endm":     (*Parser).parseUnmatchedDirective,
+		".if":       (*Parser).parseConditional,
+		".ifdef":    (*Parser).parseConditional,
+		".ifndef":   (*Parser).parseConditional,
+		".elif":     (*Parser).parseUnmatchedDirective,
+		".else":     (*Parser).parseUnmatchedDirective,
+		".endif":    (*Parser).parseUnmatchedDirective,
+		".error":    (*Parser).parseErrorDirective,
+		".rept":     (*Parser).parseRepeatDirective,
+		".irp":      (*Parser).parseIterateDirective,
+		".endr":     (*Parser).parseUnmatchedDirective,
+		".while":    (*Parser).parseWhileStatement,
+		".endwhile": (*Parser).parseUnmatchedDirective,
+		".loop":     (*Parser).parseLoopStatement,
+		".endloop":  (*Parser).parseUnmatchedDirective,
+	}
+}
+
+// All known directive names, in sorted order
+func Directives() []string {
+	var names []string
+	for name := range directives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (p *Parser) isDirective() bool {
+	return p.isCurrent(token.VALUE) && strings.HasPrefix(p.current.Lexeme, ".")
+}
+
+func (p *Parser) parseDirective() ast.Instruction {
+	parse, ok := directives[p.current.Lexeme]
+	if !ok {
+		suggestion, _ := suggest.Closest(p.current.Lexeme, Directives())
+		p.report(&Error{
+			Rule:    UnknownDirective,
+			Token:   p.current,
+			Span:    p.current.Span(),
+			Message: fmt.Sprintf("unknown directive %q", p.current.Lexeme),
+			Help:    didYouMean(suggestion),
+		})
+		return nil
+	}
+
+	return parse(p)
+}
+
+// Directives which end a block are consumed by the block they belong to, and so
+// are only parsed here when there is no such block
+func (p *Parser) parseUnmatchedDirective() ast.Instruction {
+	opening := map[string]string{
+		".endm":     ".macro",
+		".elif":     ".if",
+		".else":     ".if",
+		".endif":    ".if",
+		".endr":     ".rept or .irp",
+		".endwhile": ".while",
+		".endloop":  ".loop",
+	}[p.current.Lexeme]
+	p.report(&Error{
+		Rule:    UnmatchedDirective,
+		Token:   p.current,
+		Span:    p.current.Span(),
+		Message: fmt.Sprintf("%s without a matching %s", p.current.Lexeme, opening),
+	})
+	return nil
+}
+
+// Parses the statements of a block which started with the given directive, up until
+// one of the directives which ends it, the last of which closes the block. The ending
+// directive is consumed and returned.
+func (p *Parser) parseBlock(opening token.Token, header token.Span, ends ...string) ([]ast.Instruction, token.Token, bool) {
+	body, terminated := p.parseStatements(ends...)
+	if !terminated {
+		if !p.stopped {
+			p.report(&Error{
+				Rule:    UnterminatedBlock,
+				Token:   opening,
+				Span:    header,
+				Message: fmt.Sprintf("%s is missing a closing %s", opening.Lexeme, ends[len(ends)-1]),
+			})
+		}
+		return nil, token.Token{}, false
+	}
+
+	end := p.current
+	p.nextToken()
+	return body, end, true
+}
+
+// The macro or repetition whose body is being parsed, which is expanded elsewhere, if any
+func (p *Parser) enclosingBlock() string {
+	if p.macro != "" {
+		return fmt.Sprintf("macro %q", p.macro)
+	}
+
+	return p.repeat
+}
+
+// Each expansion of a macro or repetition would declare its variables and constants again
+func (p *Parser) checkDeclaration(opening token.Token, kind string, name string, span token.Span) bool {
+	enclosing := p.enclosingBlock()
+	if enclosing == "" {
+		return true
+	}
+
+	p.report(&Error{
+		Rule:    InvalidDeclaration,
+		Token:   opening,
+		Span:    span,
+		Message: fmt.Sprintf("%s %q can not be defined within %s, as each expansion would define it again", kind, name, enclosing),
+		Help:    fmt.Sprintf("define the %s outside of the block", kind),
+	})
+	return false
+}
+
+// VarDirective -> ".var" Value Number?
+func (p *Parser) parseVarDirective() ast.Instruction {
+	start := p.current.Pos
+	opening := p.current
+	p.advance(token.VALUE)
+
+	name := p.current
+	if !p.advance(token.VALUE) {
+		return nil
+	}
+
+	directive := &ast.VarDirective{Name: name.Lexeme}
+	if p.isCurrent(token.NUMBER) {
+		directive.Address = p.parseNumber()
+		if directive.Address == nil {
+			return nil
+		}
+	}
+
+	directive.Span = p.spanFrom(start)
+	if !p.checkDeclaration(opening, "variable", directive.Name, directive.Span) {
+		return nil
+	}
+
+	return directive
+}
+
+// ConstantDirective -> (".equ" | ".define") Value Expression
+func (p *Parser) parseConstantDirective() ast.Instruction {
+	start := p.current.Pos
+	opening := p.current
+	directive := p.current.Lexeme
+	p.advance(token.VALUE)
+
+	name := p.current
+	if !p.advance(token.VALUE) || !p.checkSymbolName("constant", name) {
+		return nil
+	}
+
+	value := p.parseExpression()
+	if value == nil || !p.checkDeclaration(opening, "constant", name.Lexeme, p.spanFrom(start)) {
+		return nil
+	}
+
+	return &ast.ConstantDirective{
+		Directive: directive,
+		Name:      name.Lexeme,
+		Value:     value,
+		Span:      p.spanFrom(start),
+	}
+}
+
+// AliasDirective -> ".alias" Value Expression
+func (p *Parser) parseAliasDirective() ast.Instruction {
+	start := p.current.Pos
+	p.advance(token.VALUE)
+
+	name := p.current
+	if !p.advance(token.VALUE) || !p.checkSymbolName("alias", name) {
+		return nil
+	}
+
+	target := p.parseExpression()
+	if target == nil {
+		return nil
+	}
+
+	return &ast.AliasDirective{Name: name.Lexeme, Target: target, Span: p.spanFrom(start)}
+}
+
+// A name made only of A, D and M is read as a register within computations and runtime
+// conditions, and so can not name a constant or alias
+func (p *Parser) checkSymbolName(kind string, name token.Token) bool {
+	if !IsRegisters(name.Lexeme) {
+		return true
+	}
+
+	p.report(&Error{
+		Rule:    InvalidSymbolName,
+		Token:   name,
+		Span:    name.Span(),
+		Message: fmt.Sprintf("%s %q would be read as a register, as it is made only of A, D and M", kind, name.Lexeme),
+		Help:    fmt.Sprintf("give the %s a name which is not made only of A, D and M", kind),
+	})
+	return false
+}
+
+// ModuleDirective -> ".module" Value
+func (p *Parser) parseModuleDirective() ast.Instruction {
+	opening := p.current
+	p.advance(token.VALUE)
+
+	name := p.current
+	if !p.advance(token.VALUE) {
+		return nil
+	}
+	directive := &ast.ModuleDirective{Name: name.Lexeme, Span: p.spanFrom(opening.Pos)}
+
+	// A module covers the rest of its file, and so can not be started by a block which is expanded elsewhere
+	if enclosing := p.enclosingBlock(); enclosing != "" {
+		p.report(&Error{
+			Rule:    InvalidModule,
+			Token:   opening,
+			Span:    directive.Span,
+			Message: fmt.Sprintf("module %q can not be started within %s", name.Lexeme, enclosing),
+			Help:    "start the module at the top level of its file",
+		})
+		return nil
+	}
+
+	if strings.Contains(name.Lexeme, ".") {
+		p.report(&Error{
+			Rule:    InvalidModule,
+			Token:   name,
+			Span:    name.Span(),
+			Message: fmt.Sprintf("module name %q can only contain letters, digits, '_' and '$'", name.Lexeme),
+			Help:    "modules are separated from their symbols by '.', such as Foo.x",
+		})
+		return nil
+	}
+
+	return directive
+}
+
+// IncludeDirective -> ".include" String
+func (p *Parser) parseIncludeDirective() ast.Instruction {
+	start := p.current.Pos
+	p.advance(token.VALUE)
+
+	path := p.parseString()
+	if path == nil {
+		return nil
+	}
+
+	return &ast.IncludeDirective{Path: *path, Span: p.spanFrom(start)}
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/token"
+)
+
+// The precedence of each binary operator, operators with a higher precedence bind more tightly.
+// Comparisons bind more tightly than & and |, as they do in C.
+var precedences = map[string]int{
+	"|":  1,
+	"&":  2,
+	"==": 3,
+	"!=": 3,
+	"<":  4,
+	"<=": 4,
+	">":  4,
+	">=": 4,
+	"<<": 5,
+	">>": 5,
+	"+":  6,
+	"-":  6,
+	"*":  7,
+	"/":  7,
+}
+
+// Expression -> Unary (BinaryOperator Unary)*
+//
+// Binary operators are parsed by precedence climbing, and are all left associative
+func (p *Parser) parseExpression() ast.AInstructionValue {
+	return p.parseBinary(1)
+}
+
+func (p *Parser) parseBinary(precedence int) ast.AInstructionValue {
+	left := p.parseUnary()
+	if left == nil {
+		return nil
+	}
+
+	for p.isCurrent(token.OPERATOR) && precedences[p.current.Lexeme] >= precedence {
+		operator := p.current.Lexeme
+		p.nextToken()
+
+		right := p.parseBinary(precedences[operator] + 1)
+		if right == nil {
+			return nil
+		}
+
+		left = &ast.BinaryExpression{
+			Operator: operator,
+			Left:     left,
+			Right:    right,
+			Span:     token.Span{Start: left.Pos(), End: right.End()},
+		}
+	}
+
+	return left
+}
+
+// Unary -> "-" Unary | Primary
+func (p *Parser) parseUnary() ast.AInstructionValue {
+	if !p.isCurrent(token.OPERATOR) || p.current.Lexeme != "-" {
+		return p.parsePrimary()
+	}
+
+	start := p.current.Pos
+	p.nextToken()
+	operand := p.parseUnary()
+	if operand == nil {
+		return nil
+	}
+
+	return &ast.UnaryExpression{Operator: "-", Operand: operand, Span: p.spanFrom(start)}
+}
+
+// Primary -> Number | Character | Symbol | "(" Expression ")"
+func (p *Parser) parsePrimary() ast.AInstructionValue {
+	switch p.current.Type {
+	case token.NUMBER:
+		if number := p.parseNumber(); number != nil {
+			return number
+		}
+	case token.CHARACTER:
+		if character := p.parseCharacter(); character != nil {
+			return character
+		}
+	case token.VALUE:
+		variable := &ast.Variable{Name: p.current.Lexeme, Span: p.current.Span()}
+		p.nextToken()
+		return variable
+	case token.LEFT_BRACKET:
+		start := p.current.Pos
+		p.nextToken()
+		expression := p.parseExpression()
+		if expression == nil || !p.advance(token.RIGHT_BRACKET) {
+			return nil
+		}
+		return &ast.ParenExpression{Expression: expression, Span: p.spanFrom(start)}
+	default:
+		p.unexpected(p.current, fmt.Sprintf("expected a number or symbol, instead got: %s", describe(p.current)))
+	}
+
+	return nil
+}
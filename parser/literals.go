@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alanfoster/assembler/symboltable"
+)
+
+// Reported when a character literal holds a single character which the Hack character set does not include
+var errNotHackCharacter = errors.New("is not in the Hack character set")
+
+// Parses a decimal number, or a hexadecimal or binary number with a 0x or 0b prefix,
+// as written within source files
+func ParseInteger(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		return strconv.ParseInt(s[2:], 16, 64)
+	case strings.HasPrefix(lower, "0b"):
+		return strconv.ParseInt(s[2:], 2, 64)
+	}
+
+	// Leading zeros do not denote octal, unlike Go
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// The escape sequences allowed within character literals, and their Hack character codes
+var escapes = map[byte]int{
+	'n':  symboltable.KeyNewline,
+	'b':  symboltable.KeyBackspace,
+	'\\': '\\',
+	'\'': '\'',
+}
+
+// Parses a character literal including its quotes, such as 'A' or '\n', into
+// its code within the Hack character set
+func parseCharacter(s string) (int, error) {
+	if !isTerminated(s) {
+		return 0, errors.New("unterminated character literal")
+	}
+
+	body := s[1 : len(s)-1]
+	switch {
+	case len(body) == 0:
+		return 0, errors.New("empty character literal")
+	case body[0] == '\\' && len(body) == 2:
+		if code, ok := escapes[body[1]]; ok {
+			return code, nil
+		}
+		return 0, fmt.Errorf("unknown escape sequence %s", body)
+	case utf8.RuneCountInString(body) > 1:
+		return 0, fmt.Errorf("character literal %s must contain a single character", s)
+	}
+
+	character, _ := utf8.DecodeRuneInString(body)
+	if character < ' ' || character > '~' {
+		return 0, fmt.Errorf("character %q %w", character, errNotHackCharacter)
+	}
+
+	return int(character), nil
+}
+
+// Parses a double quoted string, which may contain the same escape sequences as Go strings
+func parseString(s string) (string, error) {
+	if !isTerminated(s) {
+		return "", errors.New("unterminated string")
+	}
+
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid string %s", s)
+	}
+
+	return value, nil
+}
+
+// Reports whether a quoted literal ends with its closing quote, rather than an escaped quote
+func isTerminated(s string) bool {
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return false
+	}
+
+	backslashes := 0
+	for i := len(s) - 2; i > 0 && s[i] == '\\'; i-- {
+		backslashes++
+	}
+
+	return backslashes%2 == 0
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/token"
+)
+
+// MacroDefinition -> ".macro" Value (Value ("," Value)*)? Newline Statement* ".endm"
+func (p *Parser) parseMacroDefinition() ast.Instruction {
+	opening := p.current
+	p.advance(token.VALUE)
+
+	definition := p.parseMacroHeader(opening)
+	if definition == nil {
+		// The body is still consumed, so that its .endm is not reported as unmatched
+		p.synchronize()
+		p.parseBlock(opening, opening.Span(), ".endm")
+		return nil
+	}
+
+	enclosing := p.macro
+	p.macro = definition.Name
+	body, _, ok := p.parseBlock(opening, definition.Span, ".endm")
+	p.macro = enclosing
+	if !ok {
+		return nil
+	}
+
+	if enclosing != "" {
+		p.report(&Error{
+			Rule:    NestedMacro,
+			Token:   opening,
+			Span:    definition.Span,
+			Message: fmt.Sprintf("macro %q can not be defined within macro %q", definition.Name, enclosing),
+			Help:    "define the macro before the macro which uses it",
+		})
+		return nil
+	}
+	if p.repeat != "" {
+		p.report(&Error{
+			Rule:    NestedMacro,
+			Token:   opening,
+			Span:    definition.Span,
+			Message: fmt.Sprintf("macro %q can not be defined within %s", definition.Name, p.repeat),
+			Help:    "define the macro before the block which uses it",
+		})
+		return nil
+	}
+
+	definition.Body = body
+	return definition
+}
+
+func (p *Parser) parseMacroHeader(opening token.Token) *ast.MacroDefinition {
+	name := p.current
+	if !p.advance(token.VALUE) {
+		return nil
+	}
+
+	if IsRegisters(name.Lexeme) {
+		p.report(&Error{
+			Rule:    InvalidMacroName,
+			Token:   name,
+			Span:    name.Span(),
+			Message: fmt.Sprintf("macro %q can never be called, as it is parsed as a C-instruction", name.Lexeme),
+			Help:    "give the macro a name which is not made only of A, D and M",
+		})
+		return nil
+	}
+
+	definition := &ast.MacroDefinition{Name: name.Lexeme}
+	for !p.isEndOfStatement() {
+		if len(definition.Params) > 0 && !p.advance(token.COMMA) {
+			return nil
+		}
+
+		param := p.current
+		if !p.advance(token.VALUE) {
+			return nil
+		}
+		for _, existing := range definition.Params {
+			if existing == param.Lexeme {
+				p.report(&Error{
+					Rule:    DuplicateParameter,
+					Token:   param,
+					Span:    param.Span(),
+					Message: fmt.Sprintf("macro %q has more than one parameter named %q", name.Lexeme, param.Lexeme),
+				})
+				return nil
+			}
+		}
+		definition.Params = append(definition.Params, param.Lexeme)
+	}
+
+	definition.Span = p.spanFrom(opening.Pos)
+	return definition
+}
+
+// A statement starting with a symbol is a macro call, unless it is the start of a
+// C-instruction. Symbols made only of registers, such as "DM", are always parsed as a
+// C-instruction so that a mistyped computation is reported as such. The name alone
+// decides, so that an argument may start with an operator, such as PUSH -1.
+func (p *Parser) isMacroCall() bool {
+	if !p.isCurrent(token.VALUE) || p.isPeek(token.EQUALS) || p.isPeek(token.SEMICOLON) {
+		return false
+	}
+
+	return !IsRegisters(p.current.Lexeme)
+}
+
+// Reports whether a name is made only of registers, such as "DM", which is read as a
+// register rather than a symbol at the start of a statement or condition
+func IsRegisters(name string) bool {
+	return strings.Trim(name, "ADM") == ""
+}
+
+// MacroCall -> Value (Expression ("," Expression)*)?
+func (p *Parser) parseMacroCall() ast.Instruction {
+	name := p.current
+	p.advance(token.VALUE)
+
+	call := &ast.MacroCall{Name: name.Lexeme}
+	for !p.isEndOfStatement() {
+		if len(call.Args) > 0 && !p.advance(token.COMMA) {
+			return nil
+		}
+
+		arg := p.parseExpression()
+		if arg == nil {
+			return nil
+		}
+		call.Args = append(call.Args, arg)
+	}
+
+	call.Span = p.spanFrom(name.Pos)
+	return call
+}
@@ -4,20 +4,79 @@ import (
 	"github.com/alanfoster/assembler/ast"
 	"github.com/alanfoster/assembler/lexer"
 	"github.com/alanfoster/assembler/token"
+	"github.com/alanfoster/assembler/generator"
 	"bytes"
 	"fmt"
 	"strconv"
+	"errors"
 )
 
+// The number of errors which will be reported before the parser gives up
+const DefaultMaxErrors = 20
+
 type Parser struct {
-	lexer   *lexer.Lexer
-	current token.Token
-	peek    token.Token
+	lexer     *lexer.Lexer
+	previous  token.Token
+	current   token.Token
+	peek      token.Token
+	errors    []*Error
+	maxErrors int
+	// Set once too many errors have been found, so that enclosing blocks also stop parsing
+	stopped bool
+	// The name of the macro whose body is being parsed, if any
+	macro string
+	// The repetition directive whose body is being parsed, if any
+	repeat string
+	// Whether the value of a load instruction is being parsed, which may hold any 16-bit number
+	loading bool
+}
+
+// Identifiers for each kind of parse error, which are stable for use by tooling
+const (
+	InvalidCharacter        = "invalid-character"
+	UnexpectedToken         = "unexpected-token"
+	InvalidNumber           = "invalid-number"
+	NumberOutOfRange        = "number-out-of-range"
+	InvalidCharacterLiteral = "invalid-character-literal"
+	InvalidString           = "invalid-string"
+	UnknownDest             = "unknown-dest"
+	UnknownComp             = "unknown-comp"
+	UnknownJump             = "unknown-jump"
+	TrailingToken           = "trailing-token"
+	UnknownDirective        = "unknown-directive"
+	UnterminatedBlock       = "unterminated-block"
+	UnmatchedDirective      = "unmatched-directive"
+	NestedMacro             = "nested-macro"
+	DuplicateParameter      = "duplicate-parameter"
+	InvalidMacroName        = "invalid-macro-name"
+	InvalidSymbolName       = "invalid-symbol-name"
+	InvalidDeclaration      = "invalid-declaration"
+	MixedConditional        = "mixed-conditional"
+	InvalidRuntimeCondition = "invalid-runtime-condition"
+	InvalidModule           = "invalid-module"
+	TooManyErrors           = "too-many-errors"
+)
+
+// A problem found whilst parsing, along with the token that caused it.
+// The span covers the source that is in error, which may be wider than the token.
+type Error struct {
+	Rule    string
+	Token   token.Token
+	Span    token.Span
+	Message string
+	// Optional hints for fixing the error, such as a suggested spelling
+	Help  string
+	Notes []string
+}
+
+func (e *Error) Error() string {
+	return e.Message
 }
 
 func New(lexer *lexer.Lexer) *Parser {
 	parser := &Parser{
-		lexer: lexer,
+		lexer:     lexer,
+		maxErrors: DefaultMaxErrors,
 	}
 	parser.nextToken()
 	parser.nextToken()
@@ -29,61 +88,272 @@ func (p *Parser) HasMoreInstructions() bool {
 	return !p.isCurrent(token.EOF)
 }
 
+// The errors found whilst parsing the program
+func (p *Parser) Errors() []*Error {
+	return p.errors
+}
+
+// Limits the number of errors that will be reported before parsing stops.
+// A limit of zero or less will report every error.
+func (p *Parser) SetMaxErrors(maxErrors int) {
+	p.maxErrors = maxErrors
+}
+
+// Parses every instruction within the source. When an instruction is invalid an error
+// is recorded, and parsing continues from the next line. The returned program contains
+// only the instructions which were successfully parsed.
 func (p *Parser) ParseProgram() ast.Program {
-	program := ast.Program{
-		Instructions: []ast.Instruction{},
-	}
-
-	for p.HasMoreInstructions() {
-		switch p.current.Type {
-		case token.AT:
-			instr := p.parseAInstruction()
-			program.Instructions = append(program.Instructions, instr)
-		case token.LEFT_BRACKET:
-			instr := p.parseLInstruction()
-			program.Instructions = append(program.Instructions, instr)
-		default:
-			instr := p.parseCInstruction()
-			program.Instructions = append(program.Instructions, instr)
+	instructions, _ := p.parseStatements()
+	if instructions == nil {
+		instructions = []ast.Instruction{}
+	}
+
+	return ast.Program{
+		Instructions: instructions,
+	}
+}
+
+// Parses statements until the end of the file, or until one of the given directives which
+// ends the enclosing block. Reports whether the block was ended by one of those directives,
+// in which case it is the current token.
+func (p *Parser) parseStatements(terminators ...string) ([]ast.Instruction, bool) {
+	var instructions []ast.Instruction
+
+	for p.HasMoreInstructions() && !p.stopped {
+		// Blank lines, and lines containing only comments
+		if p.isCurrent(token.NEWLINE) {
+			p.nextToken()
+			continue
+		}
+
+		if p.isDirective() {
+			for _, terminator := range terminators {
+				if p.current.Lexeme == terminator {
+					return instructions, true
+				}
+			}
 		}
+
+		instr := p.parseStatement()
+		if instr == nil {
+			if p.stopped {
+				break
+			}
+			if p.hasTooManyErrors() {
+				p.addError(p.current, TooManyErrors, "too many errors")
+				p.stopped = true
+				break
+			}
+
+			p.synchronize()
+			continue
+		}
+		instructions = append(instructions, instr)
 	}
 
-	return program
+	return instructions, false
+}
+
+// Statement ->
+// 	Instruction Newline
+// 	| LInstruction Statement
+//
+// Each instruction must end at a line break, or the end of the file. Labels may be
+// followed by another instruction on the same line.
+func (p *Parser) parseStatement() ast.Instruction {
+	var instr ast.Instruction
+
+	switch p.current.Type {
+	case token.AT:
+		instr = p.parseAInstruction()
+	case token.LEFT_BRACKET:
+		instr = p.parseLInstruction()
+	default:
+		if p.isDirective() {
+			instr = p.parseDirective()
+		} else if p.isMacroCall() {
+			instr = p.parseMacroCall()
+		} else {
+			instr = p.parseCInstruction()
+		}
+	}
+
+	if instr == nil {
+		return nil
+	}
+	if _, isLabel := instr.(*ast.LInstruction); isLabel {
+		return instr
+	}
+
+	if !p.isEndOfStatement() {
+		p.trailingTokens()
+		return nil
+	}
+
+	return instr
+}
+
+func (p *Parser) isEndOfStatement() bool {
+	return p.isCurrent(token.NEWLINE) || p.isCurrent(token.EOF)
+}
+
+// Records a single error spanning every token between the end of an instruction and the end of its line
+func (p *Parser) trailingTokens() {
+	first := p.current
+	last := first
+	for !p.isEndOfStatement() {
+		last = p.current
+		p.nextToken()
+	}
+
+	if first.Type == token.INVALID {
+		p.unexpected(first, "")
+		return
+	}
+
+	p.report(&Error{
+		Rule:    TrailingToken,
+		Token:   first,
+		Span:    token.Span{Start: first.Pos, End: last.End()},
+		Message: fmt.Sprintf("unexpected %s after instruction, expected end of line", describe(first)),
+		Help:    "each instruction must be on its own line",
+	})
+}
+
+// Skips the remaining tokens on the line of the most recent error, so that
+// parsing can resume from the first token of the following line
+func (p *Parser) synchronize() {
+	for p.HasMoreInstructions() && !p.isCurrent(token.NEWLINE) {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) hasTooManyErrors() bool {
+	return p.maxErrors > 0 && len(p.errors) >= p.maxErrors
 }
 
 // @value
 //
-// Where value is a symbol or number
+// Where value is a symbol, number, or an expression of them such as SCREEN+32
 func (p *Parser) parseAInstruction() ast.Instruction {
+	start := p.current.Pos
 	p.advance(token.AT)
-	var value ast.AInstructionValue
 
-	if p.isCurrent(token.NUMBER) {
-		number, err := strconv.ParseInt(p.current.Lexeme, 10, 16)
-		if err != nil {
-			panic(err)
-		}
-		p.advance(token.NUMBER)
-		value = &ast.Number{Value: int(number)}
-	} else if p.isCurrent(token.VALUE) {
-		value = &ast.Variable{Name: p.current.Lexeme}
-		p.advance(token.VALUE)
+	operand := p.current
+	value := p.parseExpression()
+	if value == nil || !p.checkOperand(operand, value) {
+		return nil
 	}
 
 	return &ast.AInstruction{
 		Value: value,
+		Span:  p.spanFrom(start),
+	}
+}
+
+// Parses a decimal, hexadecimal or binary number. A number within an expression may be
+// larger than an instruction can hold, as only the result of the expression needs to fit.
+func (p *Parser) parseNumber() *ast.Number {
+	current := p.current
+	if !p.advance(token.NUMBER) {
+		return nil
+	}
+
+	number, err := ParseInteger(current.Lexeme)
+	if err != nil || int64(int(number)) != number {
+		p.addError(current, InvalidNumber, fmt.Sprintf("invalid number %s", current.Lexeme))
+		return nil
+	}
+
+	return &ast.Number{Value: int(number), Span: current.Span()}
+}
+
+// A number which is the whole operand of an A-instruction or load instruction must fit
+// within it. This is reported as the number was written, whereas expressions are checked
+// once they are evaluated.
+func (p *Parser) checkOperand(operand token.Token, value ast.AInstructionValue) bool {
+	number, isNumber := value.(*ast.Number)
+	if !isNumber || operand.Type != token.NUMBER {
+		return true
 	}
+
+	limit, note := generator.MaxValue, fmt.Sprintf("A-instructions can hold 0 to %d", generator.MaxValue)
+	if p.loading {
+		limit, note = generator.MaxLoadValue, fmt.Sprintf("loaded values can be %d to %d", generator.MinLoadValue, generator.MaxLoadValue)
+	}
+	if number.Value <= limit {
+		return true
+	}
+
+	notes := []string{note}
+	if strconv.Itoa(number.Value) != operand.Lexeme {
+		notes = append(notes, fmt.Sprintf("%s is %d", operand.Lexeme, number.Value))
+	}
+
+	p.report(&Error{
+		Rule:    NumberOutOfRange,
+		Token:   operand,
+		Span:    operand.Span(),
+		Message: fmt.Sprintf("constant %s is out of range", operand.Lexeme),
+		Notes:   notes,
+	})
+	return false
+}
+
+// Parses a character literal, such as 'A', into its code within the Hack character set
+func (p *Parser) parseCharacter() *ast.Number {
+	current := p.current
+	if !p.advance(token.CHARACTER) {
+		return nil
+	}
+
+	code, err := parseCharacter(current.Lexeme)
+	if err != nil {
+		invalid := &Error{
+			Rule:    InvalidCharacterLiteral,
+			Token:   current,
+			Span:    current.Span(),
+			Message: err.Error(),
+			Help:    "special keys are available as predefined symbols, such as KEY_UP",
+		}
+		if errors.Is(err, errNotHackCharacter) {
+			invalid.Notes = []string{"character literals can hold the printable ASCII characters from ' ' to '~', or an escape sequence such as '\\n'"}
+		}
+		p.report(invalid)
+		return nil
+	}
+
+	return &ast.Number{Value: code, Span: current.Span()}
+}
+
+// Parses a double quoted string, such as "math.asm"
+func (p *Parser) parseString() *string {
+	current := p.current
+	if !p.advance(token.STRING) {
+		return nil
+	}
+
+	value, err := parseString(current.Lexeme)
+	if err != nil {
+		p.addError(current, InvalidString, err.Error())
+		return nil
+	}
+
+	return &value
 }
 
 // LInstruction -> LeftBrace Value RightBrace
 func (p *Parser) parseLInstruction() ast.Instruction {
+	start := p.current.Pos
 	p.advance(token.LEFT_BRACKET)
 	value := p.current
-	p.advance(token.VALUE)
-	p.advance(token.RIGHT_BRACKET)
+	if !p.advance(token.VALUE) || !p.advance(token.RIGHT_BRACKET) {
+		return nil
+	}
 
 	return &ast.LInstruction{
 		Value: value.Lexeme,
+		Span:  p.spanFrom(start),
 	}
 }
 
@@ -92,38 +362,113 @@ func (p *Parser) parseLInstruction() ast.Instruction {
 // | Dest = Comp
 // | Comp; Jump
 // | Comp
+// | Dest = # Expression
 func (p *Parser) parseCInstruction() ast.Instruction {
+	start := p.current.Pos
 	instr := &ast.CInstruction{}
 
 	if p.isPeek(token.EQUALS) {
 		instr.Destination = p.parseDest()
-		p.advance(token.EQUALS)
+		if instr.Destination == nil || !p.advance(token.EQUALS) {
+			return nil
+		}
+
+		if p.isCurrent(token.HASH) {
+			return p.parseLoadInstruction(start, instr.Destination)
+		}
 	}
 
-	instr.Command = p.parseCommand()
+	command, ok := p.parseCommand()
+	if !ok {
+		return nil
+	}
+	if !generator.IsComp(command.Value) {
+		p.report(&Error{
+			Rule:    UnknownComp,
+			Token:   p.previous,
+			Span:    command.Span,
+			Message: fmt.Sprintf("unknown computation %q", command.Value),
+			Help:    didYouMean(suggestComp(command.Value)),
+			Notes:   []string{compNote(command.Value)},
+		})
+		return nil
+	}
+	instr.Command = command
 
 	if p.isCurrent(token.SEMICOLON) {
 		p.advance(token.SEMICOLON)
 		instr.Jump = p.parseJump()
+		if instr.Jump == nil {
+			return nil
+		}
 	}
 
+	instr.Span = p.spanFrom(start)
 	return instr
 }
 
-// Parses the destination.
-// This could ensure a valid recipient, but it does not.
+// Loads a value which may not fit in an A-instruction, such as D=#-1
+func (p *Parser) parseLoadInstruction(start token.Pos, destination *ast.Value) ast.Instruction {
+	p.advance(token.HASH)
+
+	p.loading = true
+	operand := p.current
+	value := p.parseExpression()
+	valid := value != nil && p.checkOperand(operand, value)
+	p.loading = false
+	if !valid {
+		return nil
+	}
+
+	return &ast.LoadInstruction{
+		Destination: destination,
+		Value:       value,
+		Span:        p.spanFrom(start),
+	}
+}
+
+// Parses the destination, ensuring that it is a valid recipient
 func (p *Parser) parseDest() *ast.Value {
 	current := p.current
-	p.advance(token.VALUE)
-	return &ast.Value{Value: current.Lexeme}
+	if !p.advance(token.VALUE) {
+		return nil
+	}
+
+	if !generator.IsDest(current.Lexeme) {
+		p.report(&Error{
+			Rule:    UnknownDest,
+			Token:   current,
+			Span:    current.Span(),
+			Message: fmt.Sprintf("unknown destination %q", current.Lexeme),
+			Help:    didYouMean(suggestDest(current.Lexeme)),
+			Notes:   []string{destNote()},
+		})
+		return nil
+	}
+
+	return &ast.Value{Value: current.Lexeme, Span: current.Span()}
 }
 
-// Parses the jump location.
-// This could ensure a valid Jump location, but it does not.
+// Parses the jump location. The lexer only produces jump tokens for valid
+// jumps, so any other value is reported as an unknown jump.
 func (p *Parser) parseJump() *ast.Value {
 	current := p.current
-	p.advance(token.JUMP)
-	return &ast.Value{Value: current.Lexeme}
+	if p.isCurrent(token.VALUE) {
+		p.report(&Error{
+			Rule:    UnknownJump,
+			Token:   current,
+			Span:    current.Span(),
+			Message: fmt.Sprintf("unknown jump %q", current.Lexeme),
+			Help:    didYouMean(suggestJump(current.Lexeme)),
+			Notes:   []string{jumpNote()},
+		})
+		return nil
+	}
+
+	if !p.advance(token.JUMP) {
+		return nil
+	}
+	return &ast.Value{Value: current.Lexeme, Span: current.Span()}
 }
 
 // Representation is somewhat cheaty, to make lookup easier later.
@@ -132,42 +477,48 @@ func (p *Parser) parseJump() *ast.Value {
 // 	operator Value
 // 	| Value operator Value
 // 	| Value
-func (p *Parser) parseCommand() ast.Command {
+func (p *Parser) parseCommand() (ast.Command, bool) {
 	var out bytes.Buffer
+	start := p.current.Pos
 
 	// prefix operator value
 	if p.isCurrent(token.OPERATOR) {
 		out.WriteString(p.current.Lexeme)
 		p.advance(token.OPERATOR)
-		out.WriteString(p.parseNumberOrValue().Lexeme)
-		return ast.Command{Value: out.String()}
+		operand, ok := p.parseNumberOrValue()
+		out.WriteString(operand.Lexeme)
+		return ast.Command{Value: out.String(), Span: p.spanFrom(start)}, ok
 	}
 
 	// Reading the value
-	out.WriteString(p.parseNumberOrValue().Lexeme)
+	operand, ok := p.parseNumberOrValue()
+	if !ok {
+		return ast.Command{}, false
+	}
+	out.WriteString(operand.Lexeme)
 
 	// Handle Infix
 	if p.isCurrent(token.OPERATOR) {
 		out.WriteString(p.current.Lexeme)
 		p.advance(token.OPERATOR)
-		out.WriteString(p.parseNumberOrValue().Lexeme)
+		operand, ok = p.parseNumberOrValue()
+		out.WriteString(operand.Lexeme)
 	}
 
-	return ast.Command{Value: out.String()}
+	return ast.Command{Value: out.String(), Span: p.spanFrom(start)}, ok
 }
 
-func (p *Parser) parseNumberOrValue() token.Token {
+func (p *Parser) parseNumberOrValue() (token.Token, bool) {
 	s := p.current
 	if p.isCurrent(token.NUMBER) {
-		p.advance(token.NUMBER)
-	} else {
-		p.advance(token.VALUE)
+		return s, p.advance(token.NUMBER)
 	}
 
-	return s
+	return s, p.advance(token.VALUE)
 }
 
 func (p *Parser) nextToken() {
+	p.previous = p.current
 	p.current = p.peek
 	p.peek = p.lexer.Advance()
 }
@@ -180,10 +531,47 @@ func (p *Parser) isPeek(tokenType token.Type) bool {
 	return p.peek.Type == tokenType
 }
 
-func (p *Parser) advance(tokenType token.Type) {
+// Moves past the current token, recording an error if it is not of the expected type
+func (p *Parser) advance(tokenType token.Type) bool {
 	if !p.isCurrent(tokenType) {
-		panic(fmt.Errorf("expected token type %s, instead got: %+v", tokenType, p.current))
+		p.unexpected(p.current, fmt.Sprintf("expected token type %s, instead got: %s", tokenType, describe(p.current)))
+		return false
 	}
 
 	p.nextToken()
+	return true
+}
+
+// The span from the given position until the end of the last consumed token
+func (p *Parser) spanFrom(start token.Pos) token.Span {
+	return token.Span{Start: start, End: p.previous.End()}
+}
+
+func (p *Parser) addError(tok token.Token, rule string, message string) {
+	p.report(&Error{Rule: rule, Token: tok, Span: tok.Span(), Message: message})
+}
+
+// Records an unexpected token. Characters the lexer did not understand are always
+// reported as such, rather than with the given message.
+func (p *Parser) unexpected(tok token.Token, message string) {
+	if tok.Type == token.INVALID {
+		p.addError(tok, InvalidCharacter, fmt.Sprintf("unexpected character %q", tok.Lexeme))
+	} else {
+		p.addError(tok, UnexpectedToken, message)
+	}
+}
+
+func (p *Parser) report(err *Error) {
+	p.errors = append(p.errors, err)
+}
+
+func describe(tok token.Token) string {
+	switch tok.Type {
+	case token.EOF:
+		return "end of file"
+	case token.NEWLINE:
+		return "end of line"
+	}
+
+	return fmt.Sprintf("%s %q", tok.Type, tok.Lexeme)
 }
@@ -5,6 +5,12 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/alanfoster/assembler/ast"
 	"github.com/alanfoster/assembler/lexer"
+	"github.com/alanfoster/assembler/token"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"fmt"
 )
 
 func TestAInstruction(t *testing.T) {
@@ -15,7 +21,8 @@ func TestAInstruction(t *testing.T) {
 	expected := ast.Program{
 		Instructions: []ast.Instruction{
 			&ast.AInstruction{
-				Value: &ast.Number{Value: 1337},
+				Value: &ast.Number{Value: 1337, Span: span(2, 6)},
+				Span:  span(1, 6),
 			},
 		},
 	}
@@ -33,8 +40,9 @@ func TestCInstructionBasic(t *testing.T) {
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
 				Destination: nil,
-				Command:     ast.Command{Value: "A"},
+				Command:     ast.Command{Value: "A", Span: span(1, 2)},
 				Jump:        nil,
+				Span:        span(1, 2),
 			},
 		},
 	}
@@ -52,8 +60,9 @@ func TestCInstructionPrefixCommand(t *testing.T) {
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
 				Destination: nil,
-				Command:     ast.Command{Value: "!D"},
+				Command:     ast.Command{Value: "!D", Span: span(1, 3)},
 				Jump:        nil,
+				Span:        span(1, 3),
 			},
 		},
 	}
@@ -71,8 +80,9 @@ func TestCInstructionInfixCommand(t *testing.T) {
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
 				Destination: nil,
-				Command:     ast.Command{Value: "D+1"},
+				Command:     ast.Command{Value: "D+1", Span: span(1, 4)},
 				Jump:        nil,
+				Span:        span(1, 4),
 			},
 		},
 	}
@@ -89,9 +99,10 @@ func TestCInstructionAssignment(t *testing.T) {
 	expected := ast.Program{
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
-				Destination: &ast.Value{Value: "A"},
-				Command:     ast.Command{Value: "D+1"},
+				Destination: &ast.Value{Value: "A", Span: span(1, 2)},
+				Command:     ast.Command{Value: "D+1", Span: span(3, 6)},
 				Jump:        nil,
+				Span:        span(1, 6),
 			},
 		},
 	}
@@ -109,8 +120,9 @@ func TestCInstructionAlwaysJump(t *testing.T) {
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
 				Destination: nil,
-				Command:     ast.Command{Value: "0"},
-				Jump:        &ast.Value{Value: "JGT"},
+				Command:     ast.Command{Value: "0", Span: span(1, 2)},
+				Jump:        &ast.Value{Value: "JGT", Span: span(3, 6)},
+				Span:        span(1, 6),
 			},
 		},
 	}
@@ -128,8 +140,9 @@ func TestCInstructionAssignmentJump(t *testing.T) {
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
 				Destination: nil,
-				Command:     ast.Command{Value: "D+1"},
-				Jump:        &ast.Value{Value: "JGT"},
+				Command:     ast.Command{Value: "D+1", Span: span(1, 4)},
+				Jump:        &ast.Value{Value: "JGT", Span: span(5, 8)},
+				Span:        span(1, 8),
 			},
 		},
 	}
@@ -146,9 +159,10 @@ func TestCInstructionMemoryCommand(t *testing.T) {
 	expected := ast.Program{
 		Instructions: []ast.Instruction{
 			&ast.CInstruction{
-				Destination: &ast.Value{Value: "MD"},
-				Command:     ast.Command{Value: "M-1"},
+				Destination: &ast.Value{Value: "MD", Span: span(1, 3)},
+				Command:     ast.Command{Value: "M-1", Span: span(4, 7)},
 				Jump:        nil,
+				Span:        span(1, 7),
 			},
 		},
 	}
@@ -166,6 +180,7 @@ func TestLabel(t *testing.T) {
 		Instructions: []ast.Instruction{
 			&ast.LInstruction{
 				Value: "LOOP",
+				Span:  span(1, 7),
 			},
 		},
 	}
@@ -173,3 +188,606 @@ func TestLabel(t *testing.T) {
 	assert.Equal(t, expected, result)
 	assert.Equal(t, input, result.String())
 }
+
+func TestUnexpectedTokenSkipsRestOfLine(t *testing.T) {
+	input := "(LOOP @LOOP"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, result.Instructions)
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, `expected token type RIGHT_BRACKET, instead got: AT "@"`, p.Errors()[0].Message)
+}
+
+// A span across the given columns of the first line
+func span(start int, end int) token.Span {
+	return token.Span{
+		Start: token.Pos{Line: 1, Column: start, Offset: start - 1},
+		End:   token.Pos{Line: 1, Column: end, Offset: end - 1},
+	}
+}
+
+func TestPositionsAcrossLines(t *testing.T) {
+	input := "(LOOP)\n  @LOOP\n  0;JMP"
+	l := lexer.NewFile("loop.asm", input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 3)
+	assert.Equal(t, token.Pos{File: "loop.asm", Line: 1, Column: 1, Offset: 0}, result.Instructions[0].Pos())
+	assert.Equal(t, token.Pos{File: "loop.asm", Line: 2, Column: 3, Offset: 9}, result.Instructions[1].Pos())
+	assert.Equal(t, token.Pos{File: "loop.asm", Line: 2, Column: 8, Offset: 14}, result.Instructions[1].End())
+	assert.Equal(t, token.Pos{File: "loop.asm", Line: 3, Column: 3, Offset: 17}, result.Instructions[2].Pos())
+	assert.Equal(t, token.Pos{File: "loop.asm", Line: 3, Column: 8, Offset: 22}, result.Instructions[2].End())
+}
+
+func TestRecoversAtNextLine(t *testing.T) {
+	input := `
+		@1
+		D=^M
+		M=D
+		(LOOP @LOOP
+		0;JMP
+	`
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Equal(t, "@1M=D0;JMP", result.String())
+	assert.Len(t, p.Errors(), 2)
+	assert.Equal(t, 3, p.Errors()[0].Token.Pos.Line)
+	assert.Equal(t, 5, p.Errors()[1].Token.Pos.Line)
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("D=^\n", 10)
+	l := lexer.New(input)
+	p := New(l)
+	p.SetMaxErrors(3)
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 4)
+	assert.Equal(t, "too many errors", p.Errors()[3].Message)
+}
+
+// Each file within testdata/errors annotates the lines which should fail with
+// a trailing comment of the form: // error: message
+func TestErrorCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "errors", "*.asm"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	annotation := regexp.MustCompile(`// error: (.*)$`)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+
+		var expected []string
+		for index, line := range strings.Split(string(data), "\n") {
+			if match := annotation.FindStringSubmatch(line); match != nil {
+				expected = append(expected, fmt.Sprintf("%d: %s", index+1, match[1]))
+			}
+		}
+
+		p := New(lexer.NewFile(file, string(data)))
+		p.ParseProgram()
+
+		var actual []string
+		for _, err := range p.Errors() {
+			actual = append(actual, fmt.Sprintf("%d: %s", err.Token.Pos.Line, err.Message))
+		}
+
+		assert.Equal(t, expected, actual, file)
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		help    string
+	}{
+		{"DM=M", `unknown destination "DM"`, `did you mean "MD"?`},
+		{"MAD=M", `unknown destination "MAD"`, `did you mean "AMD"?`},
+		{"DA=1", `unknown destination "DA"`, `did you mean "AD"?`},
+		{"DX=1", `unknown destination "DX"`, `did you mean "D"?`},
+		{"D=M+D", `unknown computation "M+D"`, `did you mean "D+M"?`},
+		{"D=1+D", `unknown computation "1+D"`, `did you mean "D+1"?`},
+		{"D=D+2", `unknown computation "D+2"`, `did you mean "D+1"?`},
+		{"0;JNZ", `unknown jump "JNZ"`, `did you mean "JNE"?`},
+		{"0;jmp", `unknown jump "jmp"`, ""},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		result := p.ParseProgram()
+
+		assert.Empty(t, result.Instructions, test.input)
+		assert.Len(t, p.Errors(), 1, test.input)
+		assert.Equal(t, test.message, p.Errors()[0].Message, test.input)
+		assert.Equal(t, test.help, p.Errors()[0].Help, test.input)
+	}
+}
+
+func TestUnknownComputationSpan(t *testing.T) {
+	input := "AM=M+D;JGT"
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, span(4, 7), p.Errors()[0].Span)
+}
+
+func TestNotesListValidMnemonics(t *testing.T) {
+	tests := []struct {
+		input string
+		note  string
+	}{
+		{"D=A-M", "valid computations using M are: !M, -M, D&M, D+M, D-M, D|M, M, M+1, M-1, M-D"},
+		{"D=2", "valid computations are: !A, !D, !M, -1, -A, -D, -M, 0, 1, A, A+1, A-1, A-D, D, D&A, D&M, D+1, D+A, D+M, D-1, D-A, D-M, D|A, D|M, M, M+1, M-1, M-D"},
+		{"DA=M", "valid destinations are: A, AD, AM, AMD, D, M, MD"},
+		{"0;JNZ", "valid jumps are: JEQ, JGE, JGT, JLE, JLT, JMP, JNE"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		assert.Len(t, p.Errors(), 1, test.input)
+		assert.Equal(t, []string{test.note}, p.Errors()[0].Notes, test.input)
+	}
+}
+
+func TestLabelOnSameLineAsInstruction(t *testing.T) {
+	input := "(LOOP) @LOOP\n(END) 0;JMP"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 4)
+	assert.Equal(t, "(LOOP)@LOOP(END)0;JMP", result.String())
+}
+
+func TestTrailingTokensSpanRestOfLine(t *testing.T) {
+	input := "D=M M=D @5 // comment\n@5"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Equal(t, "@5", result.String())
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, TrailingToken, p.Errors()[0].Rule)
+	assert.Equal(t, `unexpected VALUE "M" after instruction, expected end of line`, p.Errors()[0].Message)
+	assert.Equal(t, span(5, 11), p.Errors()[0].Span)
+}
+
+func TestInstructionsCanNotSpanLines(t *testing.T) {
+	input := "D\n=M"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Equal(t, "D", result.String())
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, 2, p.Errors()[0].Token.Pos.Line)
+}
+
+func TestVarDirective(t *testing.T) {
+	input := ".var counter\n.var fixed 20"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Equal(t, []ast.Instruction{
+		&ast.VarDirective{Name: "counter", Span: span(1, 13)},
+		&ast.VarDirective{
+			Name:    "fixed",
+			Address: &ast.Number{Value: 20, Span: token.Span{Start: token.Pos{Line: 2, Column: 12, Offset: 24}, End: token.Pos{Line: 2, Column: 14, Offset: 26}}},
+			Span:    token.Span{Start: token.Pos{Line: 2, Column: 1, Offset: 13}, End: token.Pos{Line: 2, Column: 14, Offset: 26}},
+		},
+	}, result.Instructions)
+}
+
+func TestUnknownDirective(t *testing.T) {
+	input := ".vra counter"
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, UnknownDirective, p.Errors()[0].Rule)
+	assert.Equal(t, `unknown directive ".vra"`, p.Errors()[0].Message)
+	assert.Equal(t, `did you mean ".var"?`, p.Errors()[0].Help)
+}
+
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"@0x4000", 0x4000},
+		{"@0X7fff", 32767},
+		{"@0b1010", 10},
+		{"@010", 10},
+		{"@'A'", 65},
+		{"@' '", 32},
+		{"@'~'", 126},
+		{`@'\n'`, 128},
+		{`@'\b'`, 129},
+		{`@'\\'`, 92},
+		{`@'\''`, 39},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		result := p.ParseProgram()
+
+		assert.Empty(t, p.Errors(), test.input)
+		assert.Equal(t, test.expected, result.Instructions[0].(*ast.AInstruction).Value.(*ast.Number).Value, test.input)
+	}
+}
+
+func TestInvalidCharacterLiterals(t *testing.T) {
+	l := lexer.New("@'é'\n@'ab'\n@'\t'")
+	p := New(l)
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 3)
+	assert.Equal(t, InvalidCharacterLiteral, p.Errors()[0].Rule)
+	assert.Equal(t, "character 'é' is not in the Hack character set", p.Errors()[0].Message)
+	assert.Equal(t, []string{
+		"character literals can hold the printable ASCII characters from ' ' to '~', or an escape sequence such as '\\n'",
+	}, p.Errors()[0].Notes)
+	assert.Equal(t, "character literal 'ab' must contain a single character", p.Errors()[1].Message)
+	assert.Empty(t, p.Errors()[1].Notes)
+	assert.Equal(t, `character '\t' is not in the Hack character set`, p.Errors()[2].Message)
+}
+
+func TestOutOfRangeLiteralNotes(t *testing.T) {
+	l := lexer.New("@0b1111000011110000")
+	p := New(l)
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, NumberOutOfRange, p.Errors()[0].Rule)
+	assert.Equal(t, []string{
+		"A-instructions can hold 0 to 32767",
+		"0b1111000011110000 is 61680",
+	}, p.Errors()[0].Notes)
+}
+
+func TestLargeLiteralsWithinExpressions(t *testing.T) {
+	l := lexer.New(".equ MASK 0xFFFF\n@(0x8000>>1)\n@0x8000-1\n@(32768)\nD=#0x10000-1")
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 5)
+	assert.Equal(t, ".equ MASK 65535", result.Instructions[0].String())
+	assert.Equal(t, "@(32768>>1)", result.Instructions[1].String())
+}
+
+func TestExpressionPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@1+2*3", "(1+(2*3))"},
+		{"@1*2+3", "((1*2)+3)"},
+		{"@1-2-3", "((1-2)-3)"},
+		{"@(1-2)-3", "(((1-2))-3)"},
+		{"@A|B&C", "(A|(B&C))"},
+		{"@A&B<<1", "(A&(B<<1))"},
+		{"@A<<1+2", "(A<<(1+2))"},
+		{"@-A*2", "((-A)*2)"},
+		{"@SCREEN+32/2", "(SCREEN+(32/2))"},
+		{"@A==1|B<2", "((A==1)|(B<2))"},
+		{"@A<B==C>=D", "((A<B)==(C>=D))"},
+		{"@1+2<3<<1", "((1+2)<(3<<1))"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		result := p.ParseProgram()
+
+		assert.Empty(t, p.Errors(), test.input)
+		assert.Equal(t, test.expected, grouped(result.Instructions[0].(*ast.AInstruction).Value), test.input)
+	}
+}
+
+// Renders an expression with every operation wrapped in parentheses, to show how it was grouped
+func grouped(value ast.AInstructionValue) string {
+	switch value := value.(type) {
+	case *ast.BinaryExpression:
+		return fmt.Sprintf("(%s%s%s)", grouped(value.Left), value.Operator, grouped(value.Right))
+	case *ast.UnaryExpression:
+		return fmt.Sprintf("(%s%s)", value.Operator, grouped(value.Operand))
+	case *ast.ParenExpression:
+		return fmt.Sprintf("(%s)", grouped(value.Expression))
+	}
+
+	return value.String()
+}
+
+func TestExpressionSpans(t *testing.T) {
+	l := lexer.New("@(A+1)*2")
+	p := New(l)
+	result := p.ParseProgram()
+
+	instruction := result.Instructions[0].(*ast.AInstruction)
+	assert.Equal(t, "@(A+1)*2", instruction.String())
+	assert.Equal(t, span(1, 9), instruction.Span)
+	assert.Equal(t, span(2, 9), nodeSpan(instruction.Value))
+	assert.Equal(t, span(2, 7), nodeSpan(instruction.Value.(*ast.BinaryExpression).Left))
+}
+
+func nodeSpan(node ast.Node) token.Span {
+	return token.Span{Start: node.Pos(), End: node.End()}
+}
+
+func TestConstantDirectives(t *testing.T) {
+	input := ".equ WIDTH 512\n.define LAST WIDTH-1"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 2)
+	assert.Equal(t, ".equ WIDTH 512", result.Instructions[0].String())
+	assert.Equal(t, ".define LAST WIDTH-1", result.Instructions[1].String())
+	assert.Equal(t, span(1, 15), nodeSpan(result.Instructions[0]))
+}
+
+func TestConstantsAndAliasesNamedAfterRegisters(t *testing.T) {
+	input := ".equ D 5\n.define AM 1\n.alias MD R13\n.equ DATA 1"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 1)
+	assert.Equal(t, ".equ DATA 1", result.Instructions[0].String())
+	assert.Len(t, p.Errors(), 3)
+	assert.Equal(t, InvalidSymbolName, p.Errors()[0].Rule)
+	assert.Equal(t, `constant "D" would be read as a register, as it is made only of A, D and M`, p.Errors()[0].Message)
+	assert.Equal(t, span(6, 7), p.Errors()[0].Span)
+	assert.Equal(t, `alias "MD" would be read as a register, as it is made only of A, D and M`, p.Errors()[2].Message)
+}
+
+func TestIncludeDirective(t *testing.T) {
+	input := ".include \"lib/screen.asm\"\n.include lib.asm\n.include \"unterminated"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 1)
+	assert.Equal(t, `.include "lib/screen.asm"`, result.Instructions[0].String())
+	assert.Equal(t, span(1, 26), nodeSpan(result.Instructions[0]))
+	assert.Len(t, p.Errors(), 2)
+}
+
+func TestMacros(t *testing.T) {
+	input := ".macro PUSH VALUE, OFFSET\n  @VALUE+OFFSET\n  D=A\n.endm\nPUSH SCREEN, 2*3\nWAIT"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 3)
+
+	definition := result.Instructions[0].(*ast.MacroDefinition)
+	assert.Equal(t, ".macro PUSH VALUE, OFFSET", definition.String())
+	assert.Equal(t, span(1, 26), nodeSpan(definition))
+	assert.Len(t, definition.Body, 2)
+	assert.Equal(t, "@VALUE+OFFSET", definition.Body[0].String())
+
+	assert.Equal(t, "PUSH SCREEN, 2*3", result.Instructions[1].String())
+	assert.Equal(t, "WAIT", result.Instructions[2].String())
+	assert.Empty(t, result.Instructions[2].(*ast.MacroCall).Args)
+}
+
+func TestMacroCallsWithOperatorArguments(t *testing.T) {
+	input := "PUSH -1\nLD -5+2, -X\nM=-1"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 3)
+	assert.Equal(t, "PUSH -1", result.Instructions[0].String())
+	assert.Equal(t, "LD -5+2, -X", result.Instructions[1].String())
+	assert.IsType(t, &ast.CInstruction{}, result.Instructions[2])
+}
+
+func TestMacrosNamedAfterRegisters(t *testing.T) {
+	input := ".macro DM\n  @R0\n.endm"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, result.Instructions)
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, InvalidMacroName, p.Errors()[0].Rule)
+	assert.Equal(t, `macro "DM" can never be called, as it is parsed as a C-instruction`, p.Errors()[0].Message)
+}
+
+func TestDeclarationsWithinMacrosAndRepetitions(t *testing.T) {
+	input := ".macro PUSH VALUE\n.equ HALF VALUE/2\n.var tmp\n.endm\n.rept 2\n.define ONE 1\n.endr"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 2)
+	assert.Empty(t, result.Instructions[0].(*ast.MacroDefinition).Body)
+	assert.Len(t, p.Errors(), 3)
+	assert.Equal(t, InvalidDeclaration, p.Errors()[0].Rule)
+	assert.Equal(t, `constant "HALF" can not be defined within macro "PUSH", as each expansion would define it again`, p.Errors()[0].Message)
+	assert.Equal(t, "define the constant outside of the block", p.Errors()[0].Help)
+	assert.Equal(t, `variable "tmp" can not be defined within macro "PUSH", as each expansion would define it again`, p.Errors()[1].Message)
+	assert.Equal(t, `constant "ONE" can not be defined within .rept, as each expansion would define it again`, p.Errors()[2].Message)
+}
+
+func TestRegistersAreNotMacroCalls(t *testing.T) {
+	input := "D\nAM"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 1)
+	assert.IsType(t, &ast.CInstruction{}, result.Instructions[0])
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, UnknownComp, p.Errors()[0].Rule)
+}
+
+func TestTooManyErrorsWithinMacro(t *testing.T) {
+	input := ".macro BROKEN\n;\n;\n;\n;\n.endm\n;"
+	l := lexer.New(input)
+	p := New(l)
+	p.SetMaxErrors(2)
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 3)
+	assert.Equal(t, TooManyErrors, p.Errors()[2].Rule)
+}
+
+func TestLoadInstructions(t *testing.T) {
+	input := "D=#-5\nAM=#0xFFFF\nD=#65536\nM=#"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 2)
+	assert.Equal(t, "D=#-5", result.Instructions[0].String())
+	assert.Equal(t, span(1, 6), nodeSpan(result.Instructions[0]))
+	assert.Equal(t, "AM=#65535", result.Instructions[1].String())
+
+	assert.Len(t, p.Errors(), 2)
+	assert.Equal(t, "constant 65536 is out of range", p.Errors()[0].Message)
+	assert.Equal(t, []string{"loaded values can be -32768 to 65535"}, p.Errors()[0].Notes)
+	assert.Equal(t, "expected a number or symbol, instead got: end of file", p.Errors()[1].Message)
+}
+
+func TestConditionals(t *testing.T) {
+	input := ".if DEBUG > 1\n@R0\n.elif DEBUG\n.else\n@R1\n@R2\n.endif\n.ifndef DEBUG\n.endif\n.error \"stop\""
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 3)
+
+	conditional := result.Instructions[0].(*ast.ConditionalDirective)
+	assert.Equal(t, ".if DEBUG>1", conditional.String())
+	assert.Equal(t, span(1, 14), nodeSpan(conditional))
+	assert.Len(t, conditional.Branches, 3)
+	assert.Len(t, conditional.Branches[0].Body, 1)
+	assert.Equal(t, ".elif DEBUG", conditional.Branches[1].String())
+	assert.Empty(t, conditional.Branches[1].Body)
+	assert.Equal(t, ".else", conditional.Branches[2].String())
+	assert.Len(t, conditional.Branches[2].Body, 2)
+
+	// Each region ends where the following branch starts
+	assert.Equal(t, 1, conditional.Branches[0].Region.Start.Line)
+	assert.Equal(t, 3, conditional.Branches[0].Region.End.Line)
+	assert.Equal(t, 4, conditional.Branches[2].Region.Start.Line)
+	assert.Equal(t, 7, conditional.Branches[2].Region.End.Line)
+
+	assert.Equal(t, ".ifndef DEBUG", result.Instructions[1].String())
+	assert.Equal(t, `.error "stop"`, result.Instructions[2].String())
+}
+
+func TestRepetitions(t *testing.T) {
+	input := ".rept 8, ROW\n@ROW\n.endr\n.irp VALUE, 1, SCREEN+1\n@VALUE\nD=A\n.endr"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 2)
+
+	repeat := result.Instructions[0].(*ast.RepeatDirective)
+	assert.Equal(t, ".rept 8, ROW", repeat.String())
+	assert.Equal(t, span(1, 13), nodeSpan(repeat))
+	assert.Equal(t, "ROW", repeat.Counter)
+	assert.Len(t, repeat.Body, 1)
+
+	iterate := result.Instructions[1].(*ast.IterateDirective)
+	assert.Equal(t, ".irp VALUE, 1, SCREEN+1", iterate.String())
+	assert.Len(t, iterate.Values, 2)
+	assert.Len(t, iterate.Body, 2)
+}
+
+func TestRuntimeStatements(t *testing.T) {
+	input := ".if D>0\nD=1\n.else\nD=0\n.endif\n.while -D<=0\n.endwhile\n.loop 8\nM=0\n.endloop"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Empty(t, p.Errors())
+	assert.Len(t, result.Instructions, 3)
+
+	statement := result.Instructions[0].(*ast.IfStatement)
+	assert.Equal(t, ".if D>0", statement.String())
+	assert.Len(t, statement.Branches, 2)
+	condition := statement.Branches[0].Condition.(*ast.RuntimeCondition)
+	assert.Equal(t, "D", condition.Computation.Value)
+	assert.Equal(t, ">", condition.Operator)
+
+	while := result.Instructions[1].(*ast.WhileStatement)
+	assert.Equal(t, ".while -D<=0", while.String())
+	assert.Equal(t, 7, while.Closing.Start.Line)
+
+	loop := result.Instructions[2].(*ast.LoopStatement)
+	assert.Equal(t, ".loop 8", loop.String())
+	assert.Len(t, loop.Body, 1)
+}
+
+func TestRuntimeConditionErrors(t *testing.T) {
+	input := ".if M>0\n.endif\n.while D>A\n.endwhile"
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	assert.Len(t, p.Errors(), 2)
+	assert.Equal(t, InvalidRuntimeCondition, p.Errors()[0].Rule)
+	assert.Equal(t, "load the value into D first, such as D=M", p.Errors()[0].Help)
+	assert.Equal(t, InvalidRuntimeCondition, p.Errors()[1].Rule)
+	assert.Equal(t, "compute the difference into D first, such as D=D-A, and then check D>0", p.Errors()[1].Help)
+}
+
+func TestModuleDirective(t *testing.T) {
+	input := ".module Math\n.module Math.Util\n.macro SETUP\n.module Setup\n.endm\n.module"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 2)
+	assert.Equal(t, ".module Math", result.Instructions[0].String())
+	assert.Equal(t, span(1, 13), nodeSpan(result.Instructions[0]))
+
+	assert.Len(t, p.Errors(), 3)
+	assert.Equal(t, InvalidModule, p.Errors()[0].Rule)
+	assert.Equal(t, `module name "Math.Util" can only contain letters, digits, '_' and '$'`, p.Errors()[0].Message)
+	assert.Equal(t, `module "Setup" can not be started within macro "SETUP"`, p.Errors()[1].Message)
+	assert.Equal(t, "expected token type VALUE, instead got: end of file", p.Errors()[2].Message)
+}
+
+func TestAliasDirective(t *testing.T) {
+	input := ".alias ret_addr R13\n.alias row SCREEN+32\n.alias missing"
+	l := lexer.New(input)
+	p := New(l)
+	result := p.ParseProgram()
+
+	assert.Len(t, result.Instructions, 2)
+	assert.Equal(t, ".alias ret_addr R13", result.Instructions[0].String())
+	assert.Equal(t, span(1, 20), nodeSpan(result.Instructions[0]))
+	assert.Equal(t, ".alias row SCREEN+32", result.Instructions[1].String())
+
+	assert.Len(t, p.Errors(), 1)
+	assert.Equal(t, "expected a number or symbol, instead got: end of file", p.Errors()[0].Message)
+}
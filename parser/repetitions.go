@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"github.com/alanfoster/assembler/ast"
+	"github.com/alanfoster/assembler/token"
+)
+
+// RepeatDirective -> ".rept" Expression ("," Value)? Newline Statement* ".endr"
+func (p *Parser) parseRepeatDirective() ast.Instruction {
+	opening := p.current
+	p.advance(token.VALUE)
+
+	directive := &ast.RepeatDirective{Count: p.parseExpression()}
+	valid := directive.Count != nil
+	if valid && p.isCurrent(token.COMMA) {
+		p.advance(token.COMMA)
+		counter := p.current
+		valid = p.advance(token.VALUE)
+		directive.Counter = counter.Lexeme
+	}
+	directive.Span = p.spanFrom(opening.Pos)
+
+	body, ok := p.parseRepetitionBody(opening, directive.Span, valid)
+	if !ok {
+		return nil
+	}
+
+	directive.Body = body
+	return directive
+}
+
+// IterateDirective -> ".irp" Value ("," Expression)+ Newline Statement* ".endr"
+func (p *Parser) parseIterateDirective() ast.Instruction {
+	opening := p.current
+	p.advance(token.VALUE)
+
+	name := p.current
+	directive := &ast.IterateDirective{Name: name.Lexeme}
+	valid := p.advance(token.VALUE)
+	// At least one value is required, so the first comma is expected even at the end of the line
+	for valid && (len(directive.Values) == 0 || !p.isEndOfStatement()) {
+		if !p.advance(token.COMMA) {
+			valid = false
+			break
+		}
+
+		value := p.parseExpression()
+		if value == nil {
+			valid = false
+			break
+		}
+		directive.Values = append(directive.Values, value)
+	}
+	directive.Span = p.spanFrom(opening.Pos)
+
+	body, ok := p.parseRepetitionBody(opening, directive.Span, valid)
+	if !ok {
+		return nil
+	}
+
+	directive.Body = body
+	return directive
+}
+
+// Parses the body of a repetition up until its .endr. The body is parsed even when the
+// header is invalid, so that its .endr is not reported as unmatched.
+func (p *Parser) parseRepetitionBody(opening token.Token, header token.Span, valid bool) ([]ast.Instruction, bool) {
+	if valid && !p.isEndOfStatement() {
+		p.trailingTokens()
+		valid = false
+	}
+	if !valid {
+		p.synchronize()
+	}
+
+	enclosing := p.repeat
+	p.repeat = opening.Lexeme
+	body, _, ok := p.parseBlock(opening, header, ".endr")
+	p.repeat = enclosing
+
+	return body, ok && valid
+}
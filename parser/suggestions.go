@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alanfoster/assembler/generator"
+	"github.com/alanfoster/assembler/suggest"
+)
+
+// Suggests a valid destination, preferring the same registers written in the expected
+// order, i.e. "DM" becomes "MD"
+func suggestDest(dest string) string {
+	var canonical []byte
+	for _, register := range "AMD" {
+		if strings.ContainsRune(dest, register) {
+			canonical = append(canonical, byte(register))
+		}
+	}
+
+	if len(canonical) == len(dest) {
+		return string(canonical)
+	}
+
+	suggestion, _ := suggest.Closest(dest, generator.Dests())
+	return suggestion
+}
+
+func suggestJump(jump string) string {
+	suggestion, _ := suggest.Closest(jump, generator.Jumps())
+	return suggestion
+}
+
+// Suggests a valid computation, preferring the operands of commutative operations
+// to be swapped, i.e. "M+D" becomes "D+M"
+func suggestComp(comp string) string {
+	if len(comp) == 3 && strings.ContainsRune("+&|", rune(comp[1])) {
+		swapped := string([]byte{comp[2], comp[1], comp[0]})
+		if generator.IsComp(swapped) {
+			return swapped
+		}
+	}
+
+	suggestion, _ := suggest.Closest(comp, generator.Comps())
+	return suggestion
+}
+
+// Lists the valid computations which use the same register as the given computation
+func compNote(comp string) string {
+	for _, register := range []string{"M", "A", "D"} {
+		if !strings.Contains(comp, register) {
+			continue
+		}
+
+		var valid []string
+		for _, candidate := range generator.Comps() {
+			if strings.Contains(candidate, register) {
+				valid = append(valid, candidate)
+			}
+		}
+		return fmt.Sprintf("valid computations using %s are: %s", register, strings.Join(valid, ", "))
+	}
+
+	return fmt.Sprintf("valid computations are: %s", strings.Join(generator.Comps(), ", "))
+}
+
+func destNote() string {
+	return fmt.Sprintf("valid destinations are: %s", strings.Join(generator.Dests(), ", "))
+}
+
+func jumpNote() string {
+	return fmt.Sprintf("valid jumps are: %s", strings.Join(generator.Jumps(), ", "))
+}
+
+func didYouMean(suggestion string) string {
+	if suggestion == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("did you mean %q?", suggestion)
+}
@@ -0,0 +1,8 @@
+// Malformed A instructions
+   @                // error: expected a number or symbol, instead got: end of line
+   =                // error: expected token type VALUE, instead got: EQUALS "="
+   @40000           // error: constant 40000 is out of range
+   @99999999999999999999 // error: invalid number 99999999999999999999
+   @;               // error: expected a number or symbol, instead got: SEMICOLON ";"
+   @SCREEN
+   M=-1
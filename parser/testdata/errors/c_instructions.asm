@@ -0,0 +1,6 @@
+// Malformed C instructions
+   D=M
+   D;M              // error: unknown jump "M"
+   ;JMP             // error: expected token type VALUE, instead got: SEMICOLON ";"
+   =D               // error: expected token type VALUE, instead got: EQUALS "="
+   0;JMP
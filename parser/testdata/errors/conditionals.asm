@@ -0,0 +1,23 @@
+// Conditional assembly
+.if DEBUG == 1
+    @R0
+.elif DEBUG > 1
+    @R1
+.else
+    @R2
+.endif
+.ifdef DEBUG junk    // error: unexpected VALUE "junk" after instruction, expected end of line
+.endif
+.ifndef              // error: expected token type VALUE, instead got: end of line
+.endif
+.if 1
+    D=M+D            // error: unknown computation "M+D"
+.else
+.elif 1              // error: .elif after .else
+.endif
+.error "stop"
+.error stop          // error: expected token type STRING, instead got: VALUE "stop"
+.else                // error: .else without a matching .if
+.endif               // error: .endif without a matching .if
+.if 1                // error: .if is missing a closing .endif
+    @R0
@@ -0,0 +1,35 @@
+// Runtime control flow
+.if D>0
+    D=1
+.elif -D>=0
+    D=0
+.else
+    D=-1
+.endif
+.while D!=0
+    D=D-1
+.endwhile
+.loop COUNT*2
+    M=0
+.endloop
+.if D>1              // error: runtime conditions compare with 0, instead got: NUMBER "1"
+.endif
+.while M>0           // error: runtime condition "M" can only use D, as jumping to a label changes A
+.endwhile
+.while D+X>0         // error: unknown computation "D+X"
+.endwhile
+.while D             // error: expected a comparison such as D>0, instead got: end of line
+.endwhile
+.while               // error: expected a runtime condition such as D>0, instead got: end of line
+.endwhile
+.if D<0
+.elif MODE           // error: expected a runtime condition such as D>0, instead got: VALUE "MODE"
+.endif
+.if MODE
+.elif D<0            // error: runtime condition within a conditional which is evaluated when assembling
+.endif
+.loop 2 3            // error: unexpected NUMBER "3" after instruction, expected end of line
+.endloop
+.endwhile            // error: .endwhile without a matching .while
+.loop 4              // error: .loop is missing a closing .endloop
+    M=0
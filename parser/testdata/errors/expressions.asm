@@ -0,0 +1,11 @@
+// Constant expressions within A instructions
+   @SCREEN+32
+   @ROWS*32-1
+   @(TABLE+3)<<1
+   @-OFFSET+10
+   @SCREEN+         // error: expected a number or symbol, instead got: end of line
+   @(TABLE+3        // error: expected token type RIGHT_BRACKET, instead got: end of line
+   @TABLE+3)        // error: unexpected RIGHT_BRACKET ")" after instruction, expected end of line
+   @1 < 2
+   @1 <> 2          // error: expected a number or symbol, instead got: OPERATOR ">"
+   @2 +* 3          // error: expected a number or symbol, instead got: OPERATOR "*"
@@ -0,0 +1,7 @@
+// Characters which are not part of the Hack language
+   @R0
+   D=D^M            // error: unexpected character "^"
+   @R1
+   D=D%M            // error: unexpected character "%"
+   M=D
+   ?                // error: unexpected character "?"
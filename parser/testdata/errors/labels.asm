@@ -0,0 +1,9 @@
+// Malformed labels
+(START              // error: expected token type RIGHT_BRACKET, instead got: end of line
+   @START
+   0;JMP
+()                  // error: expected token type VALUE, instead got: RIGHT_BRACKET ")"
+(123)               // error: expected token type VALUE, instead got: NUMBER "123"
+(END)
+   @END
+   0;JMP
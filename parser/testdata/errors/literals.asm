@@ -0,0 +1,15 @@
+// Hexadecimal, binary and character literals
+   @0x4000
+   @0b0111111111111111
+   @0b1111000011110000 // error: constant 0b1111000011110000 is out of range
+   @0x8000             // error: constant 0x8000 is out of range
+   @0xZZ               // error: invalid number 0xZZ
+   @0b102              // error: invalid number 0b102
+   @'A'
+   @'\n'
+   @'\''
+   @''                 // error: empty character literal
+   @'AB'               // error: character literal 'AB' must contain a single character
+   @'\t'               // error: unknown escape sequence \t
+   @'A                 // error: unterminated character literal
+   @KEY_UP
@@ -0,0 +1,22 @@
+// Macro definitions and calls
+.macro PUSH VALUE
+    @VALUE
+    D=A
+.endm
+.macro SWAP A, B, A  // error: macro "SWAP" has more than one parameter named "A"
+    @A
+.endm
+.macro OUTER
+.macro INNER         // error: macro "INNER" can not be defined within macro "OUTER"
+.endm
+.endm
+.macro BROKEN
+    D=M+D            // error: unknown computation "M+D"
+.endm
+    PUSH 1
+    PUSH 1, SCREEN+1
+    PUSH 1 2         // error: expected token type COMMA, instead got: NUMBER "2"
+    DM               // error: unknown computation "DM"
+.endm                // error: .endm without a matching .macro
+.macro UNTERMINATED  // error: .macro is missing a closing .endm
+    @R0
@@ -0,0 +1,10 @@
+// Destinations, computations and jumps which are not part of the Hack language
+   @R0
+   DM=M             // error: unknown destination "DM"
+   MAD=M            // error: unknown destination "MAD"
+   X=M              // error: unknown destination "X"
+   D=M+D            // error: unknown computation "M+D"
+   D=A-M            // error: unknown computation "A-M"
+   D;JNZ            // error: unknown jump "JNZ"
+   0;jmp            // error: unknown jump "jmp"
+   AMD=D+M;JGE
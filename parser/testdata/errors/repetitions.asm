@@ -0,0 +1,23 @@
+// Repeated blocks
+.rept 4
+    M=0
+.endr
+.rept ROWS*2, ROW
+    @ROW
+.endr
+.rept 2, 3           // error: expected token type VALUE, instead got: NUMBER "3"
+.endr
+.irp REGISTER, R0, R1+1
+    @REGISTER
+.endr
+.irp REGISTER        // error: expected token type COMMA, instead got: end of line
+.endr
+.irp REGISTER, R0 R1 // error: expected token type COMMA, instead got: VALUE "R1"
+.endr
+.rept 2
+.macro INNER         // error: macro "INNER" can not be defined within .rept
+.endm
+.endr
+.endr                // error: .endr without a matching .rept or .irp
+.irp X, 1            // error: .irp is missing a closing .endr
+    @X
@@ -0,0 +1,9 @@
+// Each instruction must end at a line break
+(START) @R0
+   D=M M=D          // error: unexpected VALUE "M" after instruction, expected end of line
+   @5 @6            // error: unexpected AT "@" after instruction, expected end of line
+   D                // dangling computation
+   =M               // error: expected token type VALUE, instead got: EQUALS "="
+(LOOP) (END) 0;JMP
+   0;JMP JMP        // error: unexpected JUMP "JMP" after instruction, expected end of line
+   @END
@@ -0,0 +1,104 @@
+package suggest
+
+import (
+	"sort"
+	"strings"
+)
+
+// Finds the candidate which is closest to the given word, for use within "did you mean" hints.
+// Candidates which would need too many edits to be a plausible typo are not suggested.
+func Closest(word string, candidates []string) (string, bool) {
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+
+	best := ""
+	bestDistance := maxDistance(word) + 1
+	for _, candidate := range sorted {
+		if candidate == word {
+			continue
+		}
+
+		distance := Distance(word, candidate)
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	return best, best != ""
+}
+
+// Finds the candidate which a name chosen by the user, such as a symbol, was likely meant to
+// be. Candidates which differ only in case are preferred. Unlike mnemonics, short names are
+// within a single edit of many unrelated names, such as x1 and R1, and so are only matched
+// by case.
+func ClosestName(name string, candidates []string) (string, bool) {
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+
+	for _, candidate := range sorted {
+		if candidate != name && strings.EqualFold(candidate, name) {
+			return candidate, true
+		}
+	}
+	if len(name) < 3 {
+		return "", false
+	}
+
+	return Closest(name, sorted)
+}
+
+// The number of edits allowed for a word to still be considered a typo
+func maxDistance(word string) int {
+	if len(word) < 3 {
+		return 1
+	}
+
+	return len(word) / 3
+}
+
+// The optimal string alignment distance between two strings. This is the number of
+// insertions, deletions, substitutions or transpositions of adjacent characters
+// required to turn one string into the other.
+func Distance(a string, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			rows[i][j] = minimum(
+				rows[i-1][j]+1,
+				rows[i][j-1]+1,
+				rows[i-1][j-1]+cost,
+			)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = minimum(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return rows[len(a)][len(b)]
+}
+
+func minimum(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,54 @@
+package suggest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance("LOOP", "LOOP"))
+	assert.Equal(t, 1, Distance("LOPP", "LOOP"))
+	assert.Equal(t, 1, Distance("DM", "MD"))
+	assert.Equal(t, 1, Distance("JNZ", "JNE"))
+	assert.Equal(t, 3, Distance("", "AMD"))
+	assert.Equal(t, 4, Distance("loop", "LOOP"))
+}
+
+func TestClosest(t *testing.T) {
+	suggestion, ok := Closest("JNZ", []string{"JGT", "JEQ", "JGE", "JLT", "JNE", "JLE", "JMP"})
+	assert.True(t, ok)
+	assert.Equal(t, "JNE", suggestion)
+}
+
+func TestClosestPrefersFirstCandidateOnTies(t *testing.T) {
+	suggestion, ok := Closest("OUTPUT_E", []string{"OUTPUT_F", "OUTPUT_D"})
+	assert.True(t, ok)
+	assert.Equal(t, "OUTPUT_D", suggestion)
+}
+
+func TestClosestIgnoresDistantCandidates(t *testing.T) {
+	_, ok := Closest("COUNTER", []string{"LOOP", "END"})
+	assert.False(t, ok)
+}
+
+func TestClosestName(t *testing.T) {
+	suggestion, ok := ClosestName("loop", []string{"LOOP", "LOO"})
+	assert.True(t, ok)
+	assert.Equal(t, "LOOP", suggestion)
+
+	suggestion, ok = ClosestName("COUNTR", []string{"COUNTER"})
+	assert.True(t, ok)
+	assert.Equal(t, "COUNTER", suggestion)
+}
+
+func TestClosestNameOnlyMatchesShortNamesByCase(t *testing.T) {
+	_, ok := ClosestName("x1", []string{"R1"})
+	assert.False(t, ok)
+	_, ok = ClosestName("y", []string{"X"})
+	assert.False(t, ok)
+
+	suggestion, ok := ClosestName("x", []string{"X"})
+	assert.True(t, ok)
+	assert.Equal(t, "X", suggestion)
+}
@@ -1,49 +1,232 @@
 package symboltable
 
-type SymbolTable map[string]int
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind distinguishes how a symbol was defined
+type Kind int
+
+const (
+	PREDEFINED Kind = iota
+	LABEL
+	VARIABLE
+	CONSTANT
+)
+
+func (k Kind) String() string {
+	switch k {
+	case PREDEFINED:
+		return "predefined symbol"
+	case LABEL:
+		return "label"
+	case VARIABLE:
+		return "variable"
+	case CONSTANT:
+		return "constant"
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// The value of a symbol, which is an address for labels and variables
+type Symbol struct {
+	Value int
+	Kind  Kind
+}
+
+type SymbolTable map[string]Symbol
+
+// The Hack platform's memory map
+const (
+	// The number of words of ROM, which holds the program's instructions
+	ROMSize = 0x8000
+
+	// The first RAM address after the registers R0-R15, from which variables are allocated
+	VariableBase = 16
+	// The memory mapped screen, 8K words of pixels from 0x4000 to 0x5FFF
+	ScreenBase = 0x4000
+	// The memory mapped keyboard, a single word holding the currently pressed key
+	KeyboardAddress = 0x6000
+)
+
+// The codes of the special keys within the Hack character set. Printable characters
+// use their ASCII codes, from 32 to 126.
+const (
+	KeyNewline   = 128
+	KeyBackspace = 129
+	KeyLeft      = 130
+	KeyUp        = 131
+	KeyRight     = 132
+	KeyDown      = 133
+	KeyHome      = 134
+	KeyEnd       = 135
+	KeyPageUp    = 136
+	KeyPageDown  = 137
+	KeyInsert    = 138
+	KeyDelete    = 139
+	KeyEscape    = 140
+	// The function keys F1 to F12 are numbered consecutively from 141 to 152
+	KeyF1 = 141
+)
+
+// The symbols which are defined by the Hack platform
+var predefined = map[string]int{
+	"SP":   0,
+	"LCL":  1,
+	"ARG":  2,
+	"THIS": 3,
+	"THAT": 4,
+
+	// 'Registers'
+	"R0":  0,
+	"R1":  1,
+	"R2":  2,
+	"R3":  3,
+	"R4":  4,
+	"R5":  5,
+	"R6":  6,
+	"R7":  7,
+	"R8":  8,
+	"R9":  9,
+	"R10": 10,
+	"R11": 11,
+	"R12": 12,
+	"R13": 13,
+	"R14": 14,
+	"R15": 15,
+
+	// Screen and keyboard, for Direct Memory Access
+	"SCREEN": ScreenBase,
+	"KBD":    KeyboardAddress,
+
+	// Codes of the special keys, as read from the keyboard
+	"KEY_NEWLINE":   KeyNewline,
+	"KEY_BACKSPACE": KeyBackspace,
+	"KEY_LEFT":      KeyLeft,
+	"KEY_UP":        KeyUp,
+	"KEY_RIGHT":     KeyRight,
+	"KEY_DOWN":      KeyDown,
+	"KEY_HOME":      KeyHome,
+	"KEY_END":       KeyEnd,
+	"KEY_PAGE_UP":   KeyPageUp,
+	"KEY_PAGE_DOWN": KeyPageDown,
+	"KEY_INSERT":    KeyInsert,
+	"KEY_DELETE":    KeyDelete,
+	"KEY_ESCAPE":    KeyEscape,
+	"KEY_F1":        KeyF1,
+	"KEY_F2":        KeyF1 + 1,
+	"KEY_F3":        KeyF1 + 2,
+	"KEY_F4":        KeyF1 + 3,
+	"KEY_F5":        KeyF1 + 4,
+	"KEY_F6":        KeyF1 + 5,
+	"KEY_F7":        KeyF1 + 6,
+	"KEY_F8":        KeyF1 + 7,
+	"KEY_F9":        KeyF1 + 8,
+	"KEY_F10":       KeyF1 + 9,
+	"KEY_F11":       KeyF1 + 10,
+	"KEY_F12":       KeyF1 + 11,
+}
 
 func New() SymbolTable {
-	return SymbolTable{
-		// Populate with pre-fined symbols
-		"SP":   0,
-		"LCL":  1,
-		"ARG":  2,
-		"THIS": 3,
-		"THAT": 4,
-
-		// 'Registers'
-		"R0":  0,
-		"R1":  1,
-		"R2":  2,
-		"R3":  3,
-		"R4":  4,
-		"R5":  5,
-		"R6":  6,
-		"R7":  7,
-		"R8":  8,
-		"R9":  9,
-		"R10": 10,
-		"R11": 11,
-		"R12": 12,
-		"R13": 13,
-		"R14": 14,
-		"R15": 15,
-
-		// Screen and keyboard, for Direct Memory Access
-		"SCREEN": 0x4000,
-		"KBD":    0x6000,
-	}
-}
-
-func (st SymbolTable) Add(entry string, address int) {
-	st[entry] = address
+	// Populate with pre-fined symbols
+	st := SymbolTable{}
+	for entry, address := range predefined {
+		st[entry] = Symbol{Value: address, Kind: PREDEFINED}
+	}
+	return st
+}
+
+// Reports whether the given symbol is defined by the Hack platform, such as R1 or SCREEN
+func IsPredefined(entry string) bool {
+	_, ok := predefined[entry]
+	return ok
+}
+
+// The names of every predefined symbol, in sorted order
+func Predefined() []string {
+	var names []string
+	for name := range predefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (st SymbolTable) Add(entry string, kind Kind, value int) {
+	st[entry] = Symbol{Value: value, Kind: kind}
 }
 
 func (st SymbolTable) Get(entry string) int {
-	return st[entry]
+	return st[entry].Value
+}
+
+// The kind of the given symbol, which must be contained within the table
+func (st SymbolTable) Kind(entry string) Kind {
+	return st[entry].Kind
+}
+
+// The names of every symbol of the given kind, in sorted order
+func (st SymbolTable) Names(kind Kind) []string {
+	var names []string
+	for name, symbol := range st {
+		if symbol.Kind == kind {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
 }
 
 func (st SymbolTable) Contains(entry string) bool {
 	_, ok := st[entry]
 	return ok
 }
+
+// The name of a symbol within the given module, such as Foo.x for the symbol x of module
+// Foo. Symbols outside of any module keep their name.
+func Qualify(module string, name string) string {
+	if module == "" {
+		return name
+	}
+
+	return module + "." + name
+}
+
+// The symbols defined by each module, by their name within the module. A symbol of a module
+// can only be referenced from elsewhere by its qualified name, and only once it is defined.
+type Modules map[string]map[string]bool
+
+func (m Modules) Add(module string) {
+	if m[module] == nil {
+		m[module] = map[string]bool{}
+	}
+}
+
+func (m Modules) Define(module string, name string) {
+	m.Add(module)
+	m[module][name] = true
+}
+
+func (m Modules) Defines(module string, name string) bool {
+	return m[module][name]
+}
+
+// The module whose namespace holds the given qualified name, such as Foo for Foo.x, along
+// with the name within that module
+func (m Modules) Owner(name string) (string, string, bool) {
+	dot := strings.Index(name, ".")
+	if dot <= 0 {
+		return "", "", false
+	}
+
+	module := name[:dot]
+	if _, ok := m[module]; !ok {
+		return "", "", false
+	}
+	return module, name[dot+1:], true
+}
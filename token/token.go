@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 type Type int
 
 //go:generate stringer -type=Type
@@ -12,16 +14,57 @@ const (
 	EQUALS
 	OPERATOR
 	SEMICOLON
+	COMMA
+	HASH
 	INVALID
 
 	JUMP
+	CHARACTER
+	STRING
 
+	NEWLINE
 	EOF
 )
 
+// A location within a source file. Lines and columns start from 1, whilst
+// the byte offset starts from 0.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// The region of source between two positions, the end position is exclusive
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
 type Token struct {
 	Type   Type
 	Lexeme string
+	Pos    Pos
+}
+
+// The position directly after the last character of this token
+func (t Token) End() Pos {
+	end := t.Pos
+	end.Column += len(t.Lexeme)
+	end.Offset += len(t.Lexeme)
+	return end
+}
+
+func (t Token) Span() Span {
+	return Span{Start: t.Pos, End: t.End()}
 }
 
 // The set of possible JUMP lexemes. Stores as a map for simple lookups.
@@ -4,9 +4,9 @@ package token
 
 import "fmt"
 
-const _Type_name = "VALUENUMBERLEFT_BRACKETRIGHT_BRACKETATEQUALSOPERATORSEMICOLONINVALIDJUMPEOF"
+const _Type_name = "VALUENUMBERLEFT_BRACKETRIGHT_BRACKETATEQUALSOPERATORSEMICOLONCOMMAHASHINVALIDJUMPCHARACTERSTRINGNEWLINEEOF"
 
-var _Type_index = [...]uint8{0, 5, 11, 23, 36, 38, 44, 52, 61, 68, 72, 75}
+var _Type_index = [...]uint8{0, 5, 11, 23, 36, 38, 44, 52, 61, 66, 70, 77, 81, 90, 96, 103, 106}
 
 func (i Type) String() string {
 	if i < 0 || i >= Type(len(_Type_index)-1) {